@@ -0,0 +1,184 @@
+package log
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AccessLog описывает настройки записи в лог обрабатываемых HTTP-запросов.
+// Для каждого запроса в его контекст помещается раздел лога с
+// идентификатором запроса, методом, путем и адресом клиента, который можно
+// получить с помощью FromContext. После обработки запроса в лог выводится
+// запись со статусом ответа, количеством переданных байт, длительностью
+// обработки и информацией о клиенте.
+type AccessLog struct {
+	Logger    *Logger                    // лог; по умолчанию лог по умолчанию
+	Level     func(status int) Level     // уровень записи в зависимости от статуса
+	Skip      func(r *http.Request) bool // не записывать запрос в лог
+	SkipPaths []string                   // пути запросов, не записываемые в лог
+	Combined  bool                       // текст в формате Apache combined log
+	RequestID string                     // заголовок с идентификатором запроса
+}
+
+// Handler возвращает обработчик HTTP-запросов, записывающий их в лог.
+func (a *AccessLog) Handler(next http.Handler) http.Handler {
+	var header = a.RequestID
+	if header == "" {
+		header = "X-Request-ID"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start = time.Now()
+		var id = r.Header.Get(header)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(header, id)
+		var l = a.Logger
+		if l == nil {
+			l = &h.Logger
+		}
+		l = l.With("request_id", id, "method", r.Method, "path", r.URL.Path,
+			"remote", r.RemoteAddr)
+		var rw = &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(NewContext(r.Context(), l)))
+		if a.skip(r) {
+			return
+		}
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		var lvl = statusLevel(rw.status)
+		if a.Level != nil {
+			lvl = a.Level(rw.status)
+		}
+		if !l.Enabled(lvl) {
+			return
+		}
+		var msg = "request"
+		if a.Combined {
+			msg = combinedLog(r, rw, start)
+		}
+		l.LogFields(lvl, msg,
+			Int64("status", int64(rw.status)),
+			Int64("bytes", rw.size),
+			Duration("duration", time.Since(start)),
+			String("user_agent", r.UserAgent()))
+	})
+}
+
+// skip возвращает true, если запрос не должен записываться в лог.
+func (a *AccessLog) skip(r *http.Request) bool {
+	for _, path := range a.SkipPaths {
+		if r.URL.Path == path {
+			return true
+		}
+	}
+	return a.Skip != nil && a.Skip(r)
+}
+
+// statusLevel возвращает уровень записи в лог по умолчанию для статуса
+// ответа: ERROR для ошибок сервера, WARN для ошибок клиента и INFO для
+// остальных.
+func statusLevel(status int) Level {
+	switch {
+	case status >= 500:
+		return ERROR
+	case status >= 400:
+		return WARN
+	default:
+		return INFO
+	}
+}
+
+// newRequestID возвращает новый случайный идентификатор запроса.
+func newRequestID() string {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// combinedLog возвращает описание запроса в формате Apache combined log.
+func combinedLog(r *http.Request, rw *responseWriter, start time.Time) string {
+	var buf = make(buffer, 0, 256)
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	buf.WriteString(host)
+	buf.WriteString(" - ")
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		buf.WriteString(user)
+	} else {
+		buf.WriteByte('-')
+	}
+	buf.WriteString(" [")
+	buf = start.AppendFormat(buf, "02/Jan/2006:15:04:05 -0700")
+	buf.WriteString("] \"")
+	buf.WriteString(r.Method)
+	buf.WriteByte(' ')
+	buf.WriteString(r.URL.RequestURI())
+	buf.WriteByte(' ')
+	buf.WriteString(r.Proto)
+	buf.WriteString("\" ")
+	buf = strconv.AppendInt(buf, int64(rw.status), 10)
+	buf.WriteByte(' ')
+	buf = strconv.AppendInt(buf, rw.size, 10)
+	buf.WriteByte(' ')
+	buf.WriteQuote(r.Referer())
+	buf.WriteByte(' ')
+	buf.WriteQuote(r.UserAgent())
+	return string(buf)
+}
+
+// responseWriter сохраняет статус и размер ответа на HTTP-запрос.
+type responseWriter struct {
+	http.ResponseWriter
+	status int   // код ответа
+	size   int64 // количество переданных байт
+}
+
+// WriteHeader сохраняет код ответа.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write подсчитывает количество переданных байт.
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Flush поддерживает интерфейс http.Flusher.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack поддерживает интерфейс http.Hijacker.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+// Unwrap возвращает исходный http.ResponseWriter для http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
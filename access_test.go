@@ -0,0 +1,38 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, new(Console))
+	handler := (&AccessLog{Logger: &w.Logger, SkipPaths: []string{"/health"}}).
+		Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			FromContext(r.Context()).Info("handled")
+			if r.URL.Path == "/missing" {
+				http.NotFound(rw, r)
+				return
+			}
+			rw.Write([]byte("ok"))
+		}))
+	for _, path := range []string{"/health", "/index", "/missing"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Request-ID", "id1")
+		req.Header.Set("User-Agent", "test")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+	prefix := `request_id="id1" method="GET" path="/index" remote="192.0.2.1:1234"`
+	if !strings.HasPrefix(lines[2], "INFO request "+prefix+" status=200 bytes=2 duration=") ||
+		!strings.HasSuffix(lines[2], ` user_agent="test"`) ||
+		!strings.HasPrefix(lines[4], "WARN request ") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
@@ -0,0 +1,287 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Audit описывает обработчик журнала аудита, защищенного от изменений. К
+// каждой записи добавляются поля "seq" с порядковым номером и "hash" с
+// HMAC-SHA256 от хеша предыдущей записи и текста самой записи, поэтому
+// удаление, изменение или перестановка записей обнаруживаются при проверке
+// с помощью VerifyAudit. Поле "hash" всегда выводится последним.
+//
+// Журнал записывается в формате JSON или Logfmt, в которых граница между
+// текстом сообщения и полями однозначна. Поле хеша ищется в конце строки,
+// поэтому текст сообщения или полей, похожий на поля "seq" и "hash", не
+// влияет на проверку.
+//
+// Удаление записей в конце журнала по самому журналу обнаружить нельзя:
+// для этого состояние, возвращаемое State, нужно сохранять отдельно.
+type Audit struct {
+	mu    sync.Mutex
+	w     io.Writer
+	lvl   Level
+	enc   Encoder
+	mac   hash.Hash
+	state AuditState
+	Logger
+}
+
+// AuditState описывает состояние цепочки записей журнала аудита.
+type AuditState struct {
+	Seq  uint64 // номер последней записи
+	Hash []byte // хеш последней записи
+}
+
+// Имена полей, добавляемых к записям журнала аудита.
+const (
+	AuditSeqField  = "seq"
+	AuditHashField = "hash"
+)
+
+// auditPlaceholder подставляется вместо значения хеша при его вычислении.
+var auditPlaceholder = bytes.Repeat([]byte{'0'}, sha256.Size*2)
+
+// Начало последнего поля записи с хешем в форматах JSON и Logfmt.
+var (
+	auditJSONHash   = []byte(`,"` + AuditHashField + `":"`)
+	auditLogfmtHash = []byte(" " + AuditHashField + "=")
+)
+
+// errAuditEncoder возвращается при записи в журнал аудита в формате, в
+// котором запись нельзя проверить.
+var errAuditEncoder = errors.New("log: audit requires JSON or Logfmt encoder")
+
+// NewAudit возвращает обработчик журнала аудита, выводящий записи с уровнем
+// не ниже lvl в формате enc: JSON или Logfmt. Если enc равен nil, то
+// используется JSON. Для других форматов Write возвращает ошибку. Ключ
+// используется для вычисления HMAC. Если журнал дописывается, то состояние
+// цепочки нужно восстановить с помощью Resume.
+func NewAudit(w io.Writer, lvl Level, enc Encoder, key []byte) *Audit {
+	if enc == nil {
+		enc = new(JSON)
+	}
+	var a = &Audit{w: w, lvl: lvl, enc: enc, mac: hmac.New(sha256.New, key)}
+	a.Logger = Logger{h: a}
+	return a
+}
+
+// Resume продолжает цепочку записей с указанного состояния, например,
+// полученного от VerifyAudit при проверке дописываемого журнала.
+func (a *Audit) Resume(state AuditState) {
+	a.mu.Lock()
+	a.state = AuditState{Seq: state.Seq, Hash: append([]byte(nil), state.Hash...)}
+	a.mu.Unlock()
+}
+
+// State возвращает состояние цепочки после последней записи.
+func (a *Audit) State() AuditState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return AuditState{Seq: a.state.Seq, Hash: append([]byte(nil), a.state.Hash...)}
+}
+
+// Enabled поддерживает интерфейс Enabler.
+func (a *Audit) Enabled(lvl Level, category string) bool {
+	return lvl >= a.lvl
+}
+
+// Write поддерживает интерфейс Handler. Если запись в поток не удалась, то
+// номер и хеш последней записи не изменяются.
+func (a *Audit) Write(lvl Level, category, msg string, fields []Field) error {
+	if lvl < a.lvl {
+		return nil
+	}
+	var entry = NewEntry(lvl, category, msg, fields)
+	defer entry.Free()
+	entry.Delete(AuditSeqField)
+	entry.Delete(AuditHashField)
+	var buf = getBuffer()
+	defer buf.Free()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.Timestamp = time.Now()
+	entry.Fields = append(entry.Fields, Uint64(AuditSeqField, a.state.Seq+1),
+		String(AuditHashField, string(auditPlaceholder)))
+	*buf = a.enc.Encode(*buf, entry)
+	var pos = auditHashPos(bytes.TrimSuffix(*buf, []byte{'\n'}))
+	if pos < 0 || !bytes.Equal((*buf)[pos:pos+len(auditPlaceholder)], auditPlaceholder) {
+		return errAuditEncoder
+	}
+	var sum = auditHash(a.mac, a.state.Hash, *buf)
+	hex.Encode((*buf)[pos:], sum)
+	if _, err := a.w.Write(*buf); err != nil {
+		return err
+	}
+	a.state.Seq++
+	a.state.Hash = sum
+	return nil
+}
+
+// Flush сбрасывает буферизованные данные потока, если он поддерживает метод
+// Flush или Sync.
+func (a *Audit) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch w := a.w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Sync() error }:
+		return w.Sync()
+	}
+	return nil
+}
+
+// auditHashPos возвращает позицию значения хеша в строке журнала аудита
+// без перевода строки или -1, если строка не заканчивается полем хеша в
+// формате JSON или Logfmt.
+func auditHashPos(line []byte) int {
+	var pos = len(line) - len(auditPlaceholder)
+	switch {
+	case bytes.HasSuffix(line, []byte(`"}`)) && pos >= 2 &&
+		bytes.HasSuffix(line[:pos-2], auditJSONHash):
+		return pos - 2
+	case pos >= 0 && bytes.HasSuffix(line[:pos], auditLogfmtHash):
+		return pos
+	}
+	return -1
+}
+
+// auditHash вычисляет хеш записи по хешу предыдущей записи и тексту записи с
+// подставленным вместо хеша auditPlaceholder.
+func auditHash(mac hash.Hash, prev, line []byte) []byte {
+	mac.Reset()
+	mac.Write(prev)
+	mac.Write(line)
+	return mac.Sum(nil)
+}
+
+// Ошибки проверки журнала аудита.
+var (
+	ErrAuditGap      = errors.New("log: audit entries missing")
+	ErrAuditTampered = errors.New("log: audit entry tampered")
+	ErrAuditFormat   = errors.New("log: not an audit entry")
+)
+
+// AuditError описывает нарушение, найденное при проверке журнала аудита.
+type AuditError struct {
+	Line int    // номер строки
+	Seq  uint64 // номер записи
+	Want uint64 // ожидаемый номер записи
+	Err  error  // ErrAuditGap, ErrAuditTampered или ErrAuditFormat
+}
+
+// Error поддерживает интерфейс error.
+func (e *AuditError) Error() string {
+	switch e.Err {
+	case ErrAuditGap:
+		if e.Seq < e.Want {
+			return fmt.Sprintf("line %d: entry %d repeated or out of order, want %d",
+				e.Line, e.Seq, e.Want)
+		}
+		return fmt.Sprintf("line %d: entries %d-%d missing", e.Line, e.Want, e.Seq-1)
+	case ErrAuditTampered:
+		return fmt.Sprintf("line %d: entry %d tampered", e.Line, e.Seq)
+	default:
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+}
+
+// Unwrap возвращает причину ошибки.
+func (e *AuditError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyAudit читает журнал аудита в формате dec и проверяет номера и хеши
+// записей. Найденные нарушения возвращаются списком, а проверка
+// продолжается со следующей записи, поэтому каждое нарушение сообщается
+// один раз. Возвращаемое состояние соответствует последней записи журнала
+// и может быть передано Audit.Resume или сравнено с сохраненным отдельно.
+//
+// Проверяются только записи в формате JSON или Logfmt: в формате Console
+// граница между сообщением и полями определяется неоднозначно, поэтому для
+// Console возвращается ошибка, а при использовании AutoDecoder такие записи
+// считаются нарушением формата. Кроме этого, ошибка возвращается только при
+// ошибке чтения.
+func VerifyAudit(r io.Reader, dec Decoder, key []byte) (AuditState, []*AuditError, error) {
+	switch dec.(type) {
+	case Console, *Console:
+		return AuditState{}, nil, errors.New("log: audit verification requires JSON or Logfmt")
+	}
+	var (
+		state  AuditState
+		result []*AuditError
+		mac    = hmac.New(sha256.New, key)
+		entry  Entry
+		sum    = make([]byte, sha256.Size)
+	)
+	var scanner = bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for n := 1; scanner.Scan(); n++ {
+		var line = scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		seq, value, ok := auditFields(dec, line, &entry)
+		var pos = auditHashPos(line)
+		if !ok || pos < 0 || value != string(line[pos:pos+len(auditPlaceholder)]) {
+			result = append(result, &AuditError{Line: n, Want: state.Seq + 1,
+				Err: ErrAuditFormat})
+			continue
+		}
+		if _, err := hex.Decode(sum, []byte(value)); err != nil {
+			result = append(result, &AuditError{Line: n, Seq: seq,
+				Want: state.Seq + 1, Err: ErrAuditFormat})
+			continue
+		}
+		// хеш вычисляется от строки вместе с переводом строки
+		var text = make([]byte, 0, len(line)+1)
+		text = append(append(append(text, line[:pos]...), auditPlaceholder...),
+			line[pos+len(value):]...)
+		text = append(text, '\n')
+		switch {
+		case seq != state.Seq+1:
+			// цепочка прервана, хеш предыдущей записи не известен
+			result = append(result, &AuditError{Line: n, Seq: seq,
+				Want: state.Seq + 1, Err: ErrAuditGap})
+		case !hmac.Equal(auditHash(mac, state.Hash, text), sum):
+			result = append(result, &AuditError{Line: n, Seq: seq,
+				Want: state.Seq + 1, Err: ErrAuditTampered})
+		}
+		state.Seq = seq
+		state.Hash = append(state.Hash[:0], sum...)
+	}
+	return state, result, scanner.Err()
+}
+
+// auditFields разбирает строку журнала аудита и возвращает номер записи и
+// текстовое значение ее хеша.
+func auditFields(dec Decoder, line []byte, entry *Entry) (uint64, string, bool) {
+	if dec.Decode(line, entry) != nil {
+		return 0, "", false
+	}
+	seqField, ok := entry.Lookup(AuditSeqField)
+	if !ok {
+		return 0, "", false
+	}
+	seq, err := strconv.ParseUint(seqField.text(), 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	hashField, ok := entry.Lookup(AuditHashField)
+	if !ok {
+		return 0, "", false
+	}
+	return seq, hashField.text(), true
+}
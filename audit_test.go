@@ -0,0 +1,79 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	var key = []byte("secret")
+	for _, test := range []struct {
+		enc Encoder
+		dec Decoder
+	}{
+		{new(JSON), new(JSON)},
+		{new(Logfmt), new(Logfmt)},
+		{new(Logfmt), AutoDecoder{}},
+	} {
+		var out = new(bytes.Buffer)
+		var audit = NewAudit(out, INFO, test.enc, key)
+		// текст, похожий на поля журнала, не мешает проверке
+		audit.Info("login seq=5 hash="+string(auditPlaceholder), "user", "bob",
+			"seq", 100, "note", `"hash":"`+string(auditPlaceholder)+`"}`)
+		audit.Debug("skipped")
+		audit.New("admin").Warn("delete", "id", 7)
+		audit.Info("logout", "user", "bob")
+		var log = out.String()
+
+		state, problems, err := VerifyAudit(strings.NewReader(log), test.dec, key)
+		if err != nil || len(problems) > 0 {
+			t.Fatalf("%T: verify failed: %v %v\n%s", test.enc, err, problems, log)
+		}
+		if want := audit.State(); state.Seq != 3 || !bytes.Equal(state.Hash, want.Hash) {
+			t.Errorf("%T: bad state: %d %x, want 3 %x", test.enc, state.Seq, state.Hash, want.Hash)
+		}
+		if _, problems, _ := VerifyAudit(strings.NewReader(log), test.dec,
+			[]byte("other")); len(problems) != 3 {
+			t.Errorf("%T: wrong key not detected: %v", test.enc, problems)
+		}
+
+		var lines = strings.SplitAfter(log, "\n")
+		var tampered = lines[0] + strings.Replace(lines[1], "delete", "update", 1) + lines[2]
+		_, problems, _ = VerifyAudit(strings.NewReader(tampered), test.dec, key)
+		if len(problems) != 1 || problems[0].Line != 2 ||
+			!errors.Is(problems[0], ErrAuditTampered) {
+			t.Errorf("%T: tampering not detected: %v", test.enc, problems)
+		}
+		_, problems, _ = VerifyAudit(strings.NewReader(lines[0]+lines[2]), test.dec, key)
+		if len(problems) != 1 || problems[0].Seq != 3 || problems[0].Want != 2 ||
+			!errors.Is(problems[0], ErrAuditGap) {
+			t.Errorf("%T: gap not detected: %v", test.enc, problems)
+		}
+
+		// продолжение журнала после перезапуска
+		audit = NewAudit(out, INFO, test.enc, key)
+		audit.Resume(state)
+		audit.Info("login", "user", "alice")
+		if state, problems, _ = VerifyAudit(out, test.dec, key); len(problems) > 0 || state.Seq != 4 {
+			t.Errorf("%T: resume failed: %d %v", test.enc, state.Seq, problems)
+		}
+	}
+
+	// формат Console не поддерживается
+	var console = &Console{TimeFormat: "2006-01-02 15:04:05"}
+	var out = new(bytes.Buffer)
+	var audit = NewAudit(out, INFO, console, key)
+	if err := audit.Write(INFO, "", "login", nil); err == nil || out.Len() != 0 {
+		t.Errorf("console audit written: %v %q", err, out)
+	}
+	if _, _, err := VerifyAudit(strings.NewReader(""), console, key); err == nil {
+		t.Error("console verification not rejected")
+	}
+	NewWriter(out, INFO, console).Info("login", "seq", 1, "hash", string(auditPlaceholder))
+	if _, problems, err := VerifyAudit(out, AutoDecoder{Console: *console}, key); err != nil ||
+		len(problems) != 1 || !errors.Is(problems[0], ErrAuditFormat) {
+		t.Errorf("console entry accepted: %v %v", err, problems)
+	}
+}
@@ -0,0 +1,61 @@
+package log
+
+import (
+	"io"
+	"testing"
+)
+
+var encoders = []struct {
+	name string
+	enc  Encoder
+}{
+	{"Console", &Console{TimeFormat: "2006-01-02 15:04:05"}},
+	{"Color", &Color{KeyIndent: 8}},
+	{"JSON", new(JSON)},
+	{"Logfmt", new(Logfmt)},
+}
+
+// calls описывает типичные вызовы лога, которые не должны выделять память.
+var calls = []struct {
+	name string
+	fn   func(l *Logger)
+}{
+	{"Message", func(l *Logger) { l.Info("message") }},
+	{"Pairs", func(l *Logger) { l.Info("message", "key", "value", "ok", true) }},
+	{"Typed", func(l *Logger) {
+		l.LogFields(INFO, "message", String("key", "value"),
+			Int64("count", 1024), Float64("ratio", 0.5))
+	}},
+	{"Filtered", func(l *Logger) { l.Debug("message", "key", "value") }},
+}
+
+func TestZeroAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool is not reliable with race detector")
+	}
+	for _, enc := range encoders {
+		log := NewWriter(io.Discard, INFO, enc.enc).New("bench", "id", "a1")
+		for _, call := range calls {
+			allocs := testing.AllocsPerRun(100, func() { call.fn(log) })
+			if allocs != 0 {
+				t.Errorf("%s/%s: %v allocs/op", enc.name, call.name, allocs)
+			}
+		}
+	}
+}
+
+func BenchmarkLogger(b *testing.B) {
+	for _, enc := range encoders {
+		log := NewWriter(io.Discard, INFO, enc.enc).New("bench", "id", "a1")
+		for _, call := range calls {
+			b.Run(enc.name+"/"+call.name, func(b *testing.B) {
+				b.ReportAllocs()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						call.fn(log)
+					}
+				})
+			})
+		}
+	}
+}
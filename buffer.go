@@ -19,8 +19,12 @@ func (bp *buffer) WriteString(s string) {
 func (bp *buffer) WriteQuote(s string) {
 	*bp = strconv.AppendQuote(*bp, s)
 }
-func (bp *buffer) WriteByte(c byte) {
+func (bp *buffer) WriteJSON(s string) {
+	*bp = appendJSONString(*bp, s)
+}
+func (bp *buffer) WriteByte(c byte) error {
 	*bp = append(*bp, c)
+	return nil
 }
 func (bp *buffer) WriteRune(r rune) {
 	if r < utf8.RuneSelf {
@@ -37,10 +41,26 @@ func (bp *buffer) WriteRune(r rune) {
 	*bp = b[:n+w]
 }
 func (bp *buffer) Free() {
+	// слишком большие буферы не сохраняем, чтобы не удерживать память
+	if cap(*bp) > maxBufferSize {
+		return
+	}
+	bp.Reset()
 	buffers.Put(bp)
 }
 func (bp *buffer) Reset() {
 	*bp = (*bp)[:0]
 }
 
-var buffers = sync.Pool{New: func() interface{} { return make([]byte, 0, 1<<10) }}
+// maxBufferSize задает максимальный размер буфера, возвращаемого в пул.
+const maxBufferSize = 64 << 10
+
+// getBuffer возвращает пустой буфер из пула.
+func getBuffer() *buffer {
+	return buffers.Get().(*buffer)
+}
+
+var buffers = sync.Pool{New: func() interface{} {
+	var buf = make(buffer, 0, 1<<10)
+	return &buf
+}}
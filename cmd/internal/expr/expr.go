@@ -0,0 +1,379 @@
+// Пакет expr содержит язык выражений для отбора записей лога, общий для
+// команд logview и logquery.
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mdigger/log"
+)
+
+// Expr описывает разобранное выражение фильтра.
+type Expr interface {
+	// Match возвращает true, если запись удовлетворяет выражению.
+	Match(entry *log.Entry) bool
+}
+
+// Логические операции над условиями.
+type (
+	andNode struct{ left, right Expr }
+	orNode  struct{ left, right Expr }
+	notNode struct{ expr Expr }
+)
+
+func (n andNode) Match(entry *log.Entry) bool {
+	return n.left.Match(entry) && n.right.Match(entry)
+}
+
+func (n orNode) Match(entry *log.Entry) bool {
+	return n.left.Match(entry) || n.right.Match(entry)
+}
+
+func (n notNode) Match(entry *log.Entry) bool {
+	return !n.expr.Match(entry)
+}
+
+// cond описывает условие для уровня, раздела, текста, времени или
+// дополнительного поля записи.
+type cond struct {
+	key   string         // level, category, message, time или имя поля
+	op    string         // операция сравнения; пустая проверяет наличие поля
+	value string         // значение для сравнения
+	re    *regexp.Regexp // регулярное выражение для ~ и !~
+	lvl   log.Level      // значение уровня для сравнения
+	ts    time.Time      // значение времени для сравнения
+}
+
+// Match возвращает true, если запись удовлетворяет условию.
+func (c *cond) Match(entry *log.Entry) bool {
+	switch c.key {
+	case "level", "lvl":
+		if c.re != nil {
+			return c.match(entry.Level.String())
+		}
+		return c.compare(int(entry.Level) - int(c.lvl))
+	case "category", "log":
+		return c.text(entry.Category)
+	case "message", "msg":
+		return c.text(entry.Message)
+	case "time", "ts":
+		return c.compare(entry.Timestamp.Compare(c.ts))
+	}
+	field, ok := entry.Lookup(c.key)
+	if c.op == "" || !ok {
+		return ok
+	}
+	var value = FieldText(field)
+	if c.re == nil && c.op != "=" && c.op != "!=" {
+		a, errA := strconv.ParseFloat(value, 64)
+		b, errB := strconv.ParseFloat(c.value, 64)
+		if errA == nil && errB == nil { // числа сравниваем как числа
+			switch {
+			case a < b:
+				return c.compare(-1)
+			case a > b:
+				return c.compare(1)
+			default:
+				return c.compare(0)
+			}
+		}
+	}
+	return c.text(value)
+}
+
+// text проверяет условие для строкового значения.
+func (c *cond) text(s string) bool {
+	if c.re != nil {
+		return c.match(s)
+	}
+	return c.compare(strings.Compare(s, c.value))
+}
+
+// match проверяет соответствие строки регулярному выражению.
+func (c *cond) match(s string) bool {
+	return c.re.MatchString(s) == (c.op == "~")
+}
+
+// compare возвращает результат операции сравнения по результату сравнения
+// значений: отрицательному, нулю или положительному.
+func (c *cond) compare(cmp int) bool {
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return true
+	}
+}
+
+// FieldText возвращает текстовое представление значения поля, с которым
+// сравниваются значения в выражениях.
+func FieldText(field log.Field) string {
+	switch value := field.Interface().(type) {
+	case string:
+		return value
+	case nil:
+		return "null"
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// Parse разбирает выражение фильтра. Выражение состоит из условий вида
+// "key op value", объединенных с помощью and, or, not и скобок. В качестве
+// ключа используются level, category, message, time или имя поля (поля
+// вложенных объектов задаются через точку), а в качестве операции =, !=, >,
+// >=, <, <=, ~ и !~ (соответствие регулярному выражению). Ключ без операции
+// проверяет наличие поля. Значения с пробелами и символами операций
+// задаются в кавычках:
+//
+//	level>=error and (category~^db or msg~"connection refused") and not user.id=0
+func Parse(s string) (Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	var p = parser{tokens: tokens}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return n, nil
+}
+
+// token описывает лексему выражения.
+type token struct {
+	kind byte   // 'w' - слово, 's' - строка, 'o' - операция, '(' или ')'
+	text string // текст лексемы
+}
+
+// lex разбивает выражение на лексемы.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		var c = s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{c, s[i : i+1]})
+			i++
+		case c == '"':
+			var end = i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("bad string at %d: %v", i, err)
+			}
+			tokens = append(tokens, token{'s', text})
+			i = end + 1
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, token{'w', s[i : i+2]})
+			i += 2
+		case strings.IndexByte("=!<>~", c) >= 0:
+			var end = i + 1
+			if end < len(s) && (s[end] == '=' || c == '!' && s[end] == '~') {
+				end++
+			}
+			tokens = append(tokens, token{'o', s[i:end]})
+			i = end
+		default:
+			var end = i
+			for end < len(s) && !unicode.IsSpace(rune(s[end])) &&
+				strings.IndexByte("()\"=!<>~&|", s[end]) < 0 {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{'w', s[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// parser разбирает выражение методом рекурсивного спуска.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// peek возвращает текущую лексему без перехода к следующей.
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword возвращает true и переходит к следующей лексеме, если текущая
+// лексема является одним из указанных ключевых слов.
+func (p *parser) keyword(words ...string) bool {
+	t, ok := p.peek()
+	if !ok || t.kind != 'w' && t.kind != 'o' {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.text, word) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+// or разбирает условия, объединенные с помощью or.
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or", "||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+// and разбирает условия, объединенные с помощью and.
+func (p *parser) and() (Expr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and", "&&") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+// not разбирает отрицание условия.
+func (p *parser) not() (Expr, error) {
+	if p.keyword("not", "!") {
+		n, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	return p.primary()
+}
+
+// primary разбирает условие или выражение в скобках.
+func (p *parser) primary() (Expr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case '(':
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != ')' {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return n, nil
+	case 'w':
+	default:
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	var c = &cond{key: t.text} // имена полей учитывают регистр
+	var special = isSpecial(strings.ToLower(t.text))
+	if special {
+		c.key = strings.ToLower(t.text)
+	}
+	op, ok := p.peek()
+	if !ok || op.kind != 'o' || op.text == "!" {
+		if special || isKeyword(t.text) {
+			return nil, fmt.Errorf("missing operation after %q", t.text)
+		}
+		return c, nil // проверка наличия поля
+	}
+	p.pos++
+	value, ok := p.peek()
+	if !ok || value.kind != 'w' && value.kind != 's' {
+		return nil, fmt.Errorf("missing value after %q", t.text+op.text)
+	}
+	p.pos++
+	c.op, c.value = op.text, value.text
+	if err := c.compile(); err != nil {
+		return nil, fmt.Errorf("%s%s%s: %v", t.text, op.text, value.text, err)
+	}
+	return c, nil
+}
+
+// isKeyword возвращает true для ключевых слов выражения.
+func isKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "and", "or", "not", "&&", "||":
+		return true
+	}
+	return false
+}
+
+// isSpecial возвращает true для ключей, обозначающих не дополнительное поле,
+// а уровень, раздел, текст или время записи.
+func isSpecial(key string) bool {
+	switch key {
+	case "level", "lvl", "category", "log", "message", "msg", "time", "ts":
+		return true
+	}
+	return false
+}
+
+// compile проверяет операцию и разбирает значение условия.
+func (c *cond) compile() (err error) {
+	switch c.op {
+	case "~", "!~":
+		c.re, err = regexp.Compile(c.value)
+		return err
+	case "=", "!=", ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("unknown operation %q", c.op)
+	}
+	switch c.key {
+	case "level", "lvl":
+		c.lvl, err = log.ParseLevel(c.value)
+	case "time", "ts":
+		c.ts, err = ParseTime(c.value)
+	}
+	return err
+}
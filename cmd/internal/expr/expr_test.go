@@ -0,0 +1,48 @@
+package expr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdigger/log"
+)
+
+func TestExpr(t *testing.T) {
+	var entry = &log.Entry{
+		Timestamp: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Level:     log.ERROR,
+		Category:  "db.query",
+		Message:   "connection refused",
+		Fields: []log.Field{log.Int64("status", 503), log.String("path", "/api"),
+			log.Group("user", log.Int64("id", 7))},
+	}
+	for _, test := range []struct {
+		expr string
+		want bool
+	}{
+		{"level>=warn", true},
+		{"level=error and category~^db", true},
+		{`msg~"refused$" and status>=500`, true},
+		{"status<500 or path=/api", true},
+		{"not (status>=500)", false},
+		{"user.id=7 && !user.name", true},
+		{"user.id!=7 || time<2024-05-01", false},
+		{"time>=2024-05-01T12:00:00Z and level!~^W", true},
+		{"missing", false},
+	} {
+		n, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := n.Match(entry); got != test.want {
+			t.Errorf("%s: %v", test.expr, got)
+		}
+	}
+	for _, expr := range []string{"", "level", "level>=bad", "(status=1",
+		`msg="x`, "status=1 status=2", "msg~(", "and"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
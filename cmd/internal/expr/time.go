@@ -0,0 +1,22 @@
+package expr
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseTime разбирает время в формате RFC 3339, дату с временем или без
+// него, либо интервал, отсчитываемый назад от текущего момента ("15m").
+// Время без указания зоны считается местным.
+func ParseTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05",
+		"2006-01-02T15:04:05", "2006-01-02"} {
+		if ts, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad time %q", s)
+}
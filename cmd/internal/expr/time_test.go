@@ -0,0 +1,22 @@
+package expr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	var want = time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)
+	for _, s := range []string{"2024-05-01 12:30:00", "2024-05-01T12:30:00",
+		want.Format(time.RFC3339)} {
+		if ts, err := ParseTime(s); err != nil || !ts.Equal(want) {
+			t.Errorf("%q: %v %v", s, ts, err)
+		}
+	}
+	if ts, err := ParseTime("1h"); err != nil || time.Since(ts) < time.Hour {
+		t.Errorf("bad relative time: %v %v", ts, err)
+	}
+	if _, err := ParseTime("yesterday"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,104 @@
+// Команда logaudit проверяет целостность журнала аудита, записанного с
+// помощью log.Audit: непрерывность номеров записей и цепочку их хешей.
+// Ключ HMAC читается из файла, указанного параметром -key-file, или из
+// переменной окружения LOG_AUDIT_KEY. Журнал должен быть записан в формате
+// JSON или Logfmt.
+//
+//	logaudit -key-file audit.key audit.log
+//	logaudit -key-file audit.key -seq 1024 -hash 9f86d0... audit.log
+//
+// Параметры -seq и -hash задают сохраненное отдельно состояние последней
+// записи и позволяют обнаружить удаление записей в конце журнала. При
+// обнаружении нарушений команда завершается с кодом 1.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mdigger/log"
+)
+
+func main() {
+	var (
+		keyFile = flag.String("key-file", "", "read HMAC key from `file`")
+		input   = flag.String("input", "auto", "input `format`: auto, json or logfmt")
+		seq     = flag.Uint64("seq", 0, "expected `number` of the last entry")
+		last    = flag.String("hash", "", "expected hex `hash` of the last entry")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file]\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var key = []byte(os.Getenv("LOG_AUDIT_KEY"))
+	if *keyFile != "" {
+		data, err := os.ReadFile(*keyFile)
+		if err != nil {
+			fatal(err)
+		}
+		key = bytes.TrimRight(data, "\r\n")
+	}
+	if len(key) == 0 {
+		fatal(fmt.Errorf("HMAC key is not set"))
+	}
+	var dec log.Decoder
+	switch *input {
+	case "auto":
+		dec = log.AutoDecoder{}
+	case "json":
+		dec = new(log.JSON)
+	case "logfmt":
+		dec = new(log.Logfmt)
+	default:
+		fatal(fmt.Errorf("unknown input format %q", *input))
+	}
+	var r io.Reader = os.Stdin
+	if flag.NArg() == 1 {
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fatal(err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var out = bufio.NewWriter(os.Stdout)
+	state, problems, err := log.VerifyAudit(r, dec, key)
+	if err != nil {
+		fatal(err)
+	}
+	for _, problem := range problems {
+		fmt.Fprintln(out, problem)
+	}
+	var failed = len(problems) > 0
+	if *seq > 0 && state.Seq != *seq {
+		fmt.Fprintf(out, "last entry %d, want %d\n", state.Seq, *seq)
+		failed = true
+	} else if *last != "" && hex.EncodeToString(state.Hash) != *last {
+		fmt.Fprintf(out, "last entry %d: hash mismatch\n", state.Seq)
+		failed = true
+	}
+	fmt.Fprintf(out, "%d entries, last hash %x\n", state.Seq, state.Hash)
+	out.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// fatal выводит описание ошибки и завершает программу.
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "logaudit:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,123 @@
+// Команда logdecrypt расшифровывает лог, записанный через log.Encrypter, и
+// выводит записи в исходном виде. Ключи задаются параметром -key в виде
+// "id=файл" (параметр можно повторять); файл содержит ключ длиной 16, 24 или
+// 32 байта в двоичном виде или в шестнадцатеричной записи.
+//
+//	logdecrypt -key 2024-05=keys/2024-05.key app.log.enc | logview
+//
+// Записи, которые не удалось расшифровать, пропускаются с выводом описания
+// ошибки, и команда завершается с кодом 1.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mdigger/log"
+)
+
+func main() {
+	var keys = make(keyList)
+	flag.Var(keys, "key", "decryption key as `id=file` (may be repeated)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -key id=file [file ...]\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if len(keys) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var out = bufio.NewWriter(os.Stdout)
+	var failed bool
+	var files = flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		var r io.Reader = os.Stdin
+		if name != "-" {
+			file, err := os.Open(name)
+			if err != nil {
+				fatal(err)
+			}
+			defer file.Close()
+			r = file
+		}
+		dec, err := log.NewDecrypter(r, keys)
+		if err != nil {
+			fatal(err)
+		}
+		for n := 1; ; n++ {
+			data, err := dec.Next()
+			var keyErr *log.KeyError
+			switch {
+			case err == nil:
+				out.Write(data)
+				continue
+			case err == io.EOF:
+			case errors.Is(err, log.ErrDecrypt), errors.As(err, &keyErr):
+				out.Flush()
+				fmt.Fprintf(os.Stderr, "logdecrypt: %s: record %d: %v\n", name, n, err)
+				failed = true
+				continue
+			default: // дальнейшие записи прочитать нельзя
+				out.Flush()
+				fmt.Fprintf(os.Stderr, "logdecrypt: %s: record %d: %v\n", name, n, err)
+				failed = true
+			}
+			break
+		}
+	}
+	out.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// fatal выводит описание ошибки и завершает программу.
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "logdecrypt:", err)
+	os.Exit(1)
+}
+
+// keyList поддерживает задание нескольких ключей в параметрах.
+type keyList map[string][]byte
+
+// String поддерживает интерфейс flag.Value.
+func (l keyList) String() string {
+	var ids = make([]string, 0, len(l))
+	for id := range l {
+		ids = append(ids, id)
+	}
+	return strings.Join(ids, ",")
+}
+
+// Set поддерживает интерфейс flag.Value.
+func (l keyList) Set(s string) error {
+	id, name, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("bad key %q, want id=file", s)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	var key = bytes.TrimSpace(data)
+	if decoded, err := hex.DecodeString(string(key)); err == nil {
+		key = decoded
+	} else {
+		key = data // ключ в двоичном виде
+	}
+	l[id] = key
+	return nil
+}
@@ -0,0 +1,336 @@
+// Команда logquery выполняет поиск и подсчет записей в файлах лога в формате
+// JSON, Logfmt или Console, в том числе сжатых с помощью gzip после ротации.
+// Записи отбираются с помощью выражения фильтра и выводятся как есть, либо
+// подсчитываются: всего, по значениям поля или по интервалам времени.
+//
+//	logquery -since 1h -where 'level>=error' -by category app.log app.log.1.gz
+//	logquery -where 'category~^http and status>=500' -by path -n 10 app.log
+//	logquery -where 'msg~timeout' -hist 5m app.log
+//
+// Подробнее о синтаксисе выражений смотри описание expr.Parse.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mdigger/log"
+	"github.com/mdigger/log/cmd/internal/expr"
+)
+
+func main() {
+	var (
+		where  = flag.String("where", "", "filter `expression`")
+		since  = flag.String("since", "", "select entries after `time` (RFC 3339 or duration ago)")
+		until  = flag.String("until", "", "select entries before `time` (RFC 3339 or duration ago)")
+		count  = flag.Bool("count", false, "output the number of matching entries")
+		by     = flag.String("by", "", "count entries by values of `key` (level, category, message or field)")
+		limit  = flag.Int("n", 0, "output only the first `n` results")
+		hist   = flag.Duration("hist", 0, "count entries by time buckets of `duration`")
+		format = flag.String("format", "json", "output `format` of entries: json, logfmt, console or color")
+		inTime = flag.String("input-time", "2006-01-02 15:04:05", "time `layout` of console input")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file ...]\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var q = &query{
+		dec:   log.AutoDecoder{Console: log.Console{TimeFormat: *inTime}},
+		limit: *limit,
+	}
+	var err error
+	if *where != "" {
+		if q.filter, err = expr.Parse(*where); err != nil {
+			fatal(fmt.Errorf("bad expression: %v", err))
+		}
+	}
+	if *since != "" {
+		if q.since, err = expr.ParseTime(*since); err != nil {
+			fatal(err)
+		}
+	}
+	if *until != "" {
+		if q.until, err = expr.ParseTime(*until); err != nil {
+			fatal(err)
+		}
+	}
+	var out = bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	switch {
+	case *hist > 0:
+		q.result = &histogram{bucket: *hist, counts: make(map[time.Time]int)}
+	case *by != "":
+		q.result = &counter{key: *by, counts: make(map[string]int)}
+	case *count:
+		q.result = new(total)
+	default:
+		var enc log.Encoder
+		switch *format {
+		case "json":
+			enc = new(log.JSON)
+		case "logfmt":
+			enc = new(log.Logfmt)
+		case "console", "std":
+			enc = &log.Console{TimeFormat: "2006-01-02 15:04:05"}
+		case "color":
+			enc = new(log.Color)
+		default:
+			fatal(fmt.Errorf("unknown format %q", *format))
+		}
+		q.result = &printer{w: out, enc: enc, limit: *limit}
+	}
+
+	var files = flag.Args()
+	if len(files) == 0 {
+		if err := q.read(os.Stdin); err != nil {
+			fatal(err)
+		}
+	}
+	for _, name := range files {
+		if q.done {
+			break
+		}
+		if err := q.readFile(name); err != nil {
+			fatal(fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	q.result.output(out, q.limit)
+}
+
+// fatal выводит описание ошибки и завершает программу.
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "logquery:", err)
+	os.Exit(1)
+}
+
+// query описывает запрос к файлам лога.
+type query struct {
+	dec    log.Decoder // формат разбора строк
+	filter expr.Expr   // выражение фильтра
+	since  time.Time   // начало интервала времени
+	until  time.Time   // окончание интервала времени
+	limit  int         // ограничение количества результатов
+	result result      // обработчик отобранных записей
+	done   bool        // получено достаточно результатов
+	entry  log.Entry   // разобранная запись
+}
+
+// readFile читает записи из файла. Сжатые с помощью gzip файлы
+// определяются по содержимому и распаковываются. Если файл записан с
+// помощью log.Compressor, то блоки до начала интервала времени пропускаются
+// без распаковки.
+func (q *query) readFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r = bufio.NewReader(file)
+	if magic, err := r.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		if !q.since.IsZero() { // пропускаем блоки до начала интервала
+			if info, err := file.Stat(); err == nil {
+				if blocks, err := log.SeekBlocks(file, info.Size(), q.since); err == nil {
+					return q.read(blocks)
+				}
+			}
+		}
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return q.read(gz)
+	}
+	return q.read(r)
+}
+
+// read читает записи из потока и передает отобранные обработчику. Строки, не
+// являющиеся записями лога, пропускаются.
+func (q *query) read(r io.Reader) error {
+	var scanner = bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var line = bytes.TrimRight(scanner.Bytes(), "\r")
+		if q.dec.Decode(line, &q.entry) != nil || !q.match(&q.entry) {
+			continue
+		}
+		if !q.result.add(&q.entry) {
+			q.done = true // получено достаточно результатов
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// match возвращает true, если запись удовлетворяет условиям запроса.
+func (q *query) match(entry *log.Entry) bool {
+	if !q.since.IsZero() && entry.Timestamp.Before(q.since) {
+		return false
+	}
+	if !q.until.IsZero() && !entry.Timestamp.Before(q.until) {
+		return false
+	}
+	return q.filter == nil || q.filter.Match(entry)
+}
+
+// result описывает обработчик отобранных записей.
+type result interface {
+	add(entry *log.Entry) bool // возвращает false, если записей достаточно
+	output(w io.Writer, limit int)
+}
+
+// printer выводит отобранные записи в указанном формате.
+type printer struct {
+	w     io.Writer   // поток для вывода
+	enc   log.Encoder // формат вывода
+	limit int         // максимальное количество записей
+	n     int         // количество выведенных записей
+	buf   []byte      // буфер для формирования записи
+}
+
+func (p *printer) add(entry *log.Entry) bool {
+	p.buf = p.enc.Encode(p.buf[:0], entry)
+	p.w.Write(p.buf)
+	p.n++
+	return p.limit <= 0 || p.n < p.limit
+}
+
+func (p *printer) output(io.Writer, int) {}
+
+// total подсчитывает количество отобранных записей.
+type total int
+
+func (t *total) add(*log.Entry) bool {
+	*t++
+	return true
+}
+
+func (t *total) output(w io.Writer, _ int) {
+	fmt.Fprintln(w, int(*t))
+}
+
+// counter подсчитывает количество записей для каждого значения ключа.
+type counter struct {
+	key    string
+	counts map[string]int
+}
+
+func (c *counter) add(entry *log.Entry) bool {
+	c.counts[keyValue(entry, c.key)]++
+	return true
+}
+
+// output выводит значения в порядке убывания количества записей.
+func (c *counter) output(w io.Writer, limit int) {
+	var values = make([]string, 0, len(c.counts))
+	for value := range c.counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if c.counts[values[i]] != c.counts[values[j]] {
+			return c.counts[values[i]] > c.counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if limit > 0 && len(values) > limit {
+		values = values[:limit]
+	}
+	for _, value := range values {
+		fmt.Fprintf(w, "%7d  %s\n", c.counts[value], value)
+	}
+}
+
+// keyValue возвращает значение ключа записи для группировки. Для
+// отсутствующих полей возвращается "-".
+func keyValue(entry *log.Entry, key string) string {
+	switch strings.ToLower(key) {
+	case "level", "lvl":
+		return entry.Level.String()
+	case "category", "log":
+		return entry.Category
+	case "message", "msg":
+		return entry.Message
+	}
+	if field, ok := entry.Lookup(key); ok {
+		return expr.FieldText(field)
+	}
+	return "-"
+}
+
+// histogram подсчитывает количество записей по интервалам времени.
+type histogram struct {
+	bucket time.Duration
+	counts map[time.Time]int
+}
+
+func (h *histogram) add(entry *log.Entry) bool {
+	h.counts[entry.Timestamp.Truncate(h.bucket)]++
+	return true
+}
+
+// histWidth задает максимальную длину полосы гистограммы.
+const histWidth = 50
+
+// histGap задает максимальное количество интервалов без записей подряд,
+// которые выводятся в гистограмме. Более длинные промежутки заменяются
+// одной строкой с их количеством.
+const histGap = 10
+
+// output выводит интервалы в порядке возрастания времени и полосы с длиной,
+// пропорциональной количеству записей. Короткие промежутки без записей
+// выводятся нулевыми интервалами, а длинные сокращаются.
+func (h *histogram) output(w io.Writer, limit int) {
+	var times = make([]time.Time, 0, len(h.counts))
+	var peak int
+	for ts, n := range h.counts {
+		times = append(times, ts)
+		if n > peak {
+			peak = n
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	var tw = tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	var lines int
+	var line = func(ts time.Time, n int) bool {
+		if limit > 0 && lines >= limit {
+			return false
+		}
+		lines++
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", ts.Local().Format("2006-01-02 15:04:05"),
+			n, strings.Repeat("#", (n*histWidth+peak-1)/peak))
+		return true
+	}
+	for i, ts := range times {
+		if limit > 0 && lines >= limit {
+			break
+		}
+		if i > 0 {
+			var prev = times[i-1]
+			if gap := int(ts.Sub(prev)/h.bucket) - 1; gap > histGap {
+				fmt.Fprintf(tw, "...\t\t%d empty buckets\n", gap)
+			} else {
+				for empty := prev.Add(h.bucket); empty.Before(ts); empty = empty.Add(h.bucket) {
+					if !line(empty, 0) {
+						break
+					}
+				}
+			}
+		}
+		if !line(ts, h.counts[ts]) {
+			break
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdigger/log"
+	"github.com/mdigger/log/cmd/internal/expr"
+)
+
+func TestQuery(t *testing.T) {
+	var name = filepath.Join(t.TempDir(), "app.log.1.gz")
+	file, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gz = gzip.NewWriter(file)
+	var w = log.NewWriter(gz, log.TRACE, new(log.JSON))
+	w.New("db").Error("failed")
+	w.New("db").Info("ok")
+	w.New("http").Error("failed", "status", 500)
+	gz.Close()
+	file.Close()
+
+	filter, err := expr.Parse("level>=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c = &counter{key: "category", counts: make(map[string]int)}
+	var q = &query{dec: log.AutoDecoder{}, filter: filter, result: c}
+	if err := q.readFile(name); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	c.output(&out, 0)
+	if got, want := out.String(), "      1  db\n      1  http\n"; got != want {
+		t.Errorf("bad counts: %q, want %q", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var h = &histogram{bucket: time.Minute, counts: make(map[time.Time]int)}
+	for _, offset := range []int{0, 0, 1, 3, 1000} {
+		h.add(&log.Entry{Timestamp: start.Add(time.Duration(offset) * time.Minute)})
+	}
+	var out = new(strings.Builder)
+	h.output(out, 0)
+	var lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 6 || !strings.Contains(lines[2], " 0 ") ||
+		!strings.HasPrefix(lines[4], "...") || !strings.HasSuffix(lines[4], " 996 empty buckets") {
+		t.Errorf("unexpected histogram:\n%s", out)
+	}
+	out.Reset()
+	h.output(out, 2)
+	if n := strings.Count(out.String(), "\n"); n != 2 {
+		t.Errorf("limit ignored:\n%s", out)
+	}
+}
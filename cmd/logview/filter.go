@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mdigger/log"
+)
+
+// filter описывает условия отбора записей лога.
+type filter struct {
+	level    log.Level // минимальный уровень
+	hasLevel bool      // уровень задан
+	category string    // префикс раздела
+	message  string    // подстрока текста сообщения
+	since    time.Time // начало интервала времени
+	until    time.Time // окончание интервала времени
+	where    exprList  // условия для полей
+}
+
+// empty возвращает true, если не задано ни одного условия.
+func (f *filter) empty() bool {
+	return !f.hasLevel && f.category == "" && f.message == "" &&
+		f.since.IsZero() && f.until.IsZero() && len(f.where.exprs) == 0
+}
+
+// match возвращает true, если запись удовлетворяет всем условиям. Префикс
+// раздела учитывает вложенность: "db" соответствует разделам "db" и
+// "db.query", но не "dbx".
+func (f *filter) match(entry *log.Entry) bool {
+	if f.hasLevel && entry.Level < f.level {
+		return false
+	}
+	if f.category != "" && entry.Category != f.category &&
+		!strings.HasPrefix(entry.Category, f.category+".") {
+		return false
+	}
+	if f.message != "" && !strings.Contains(entry.Message, f.message) {
+		return false
+	}
+	if !f.since.IsZero() && entry.Timestamp.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !entry.Timestamp.Before(f.until) {
+		return false
+	}
+	for _, e := range f.where.exprs {
+		if !e.Match(entry) {
+			return false
+		}
+	}
+	return true
+}
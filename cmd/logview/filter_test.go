@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mdigger/log"
+)
+
+func TestFilter(t *testing.T) {
+	var entry = new(log.Entry)
+	err := log.JSON{}.Decode([]byte(`{"ts":1714556400,"lvl":40,"log":"db.query",`+
+		`"msg":"slow query","took":1.5,"http":{"status":503,"path":"/api"},`+
+		`"tags":["a","b"],"ok":false}`), entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var where = func(exprs ...string) exprList {
+		var l exprList
+		for _, e := range exprs {
+			if err := l.Set(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return l
+	}
+	for _, test := range []struct {
+		filter filter
+		want   bool
+	}{
+		{filter{}, true},
+		{filter{level: log.WARN, hasLevel: true}, true},
+		{filter{level: log.ERROR, hasLevel: true}, false},
+		{filter{category: "db"}, true},
+		{filter{category: "d"}, false},
+		{filter{message: "slow"}, true},
+		{filter{where: where("http.status>=500")}, true},
+		{filter{where: where("http.status<500")}, false},
+		{filter{where: where("http.path~api", "ok=false")}, true},
+		{filter{where: where("http.path~api", "took>2")}, false},
+		{filter{where: where("user")}, false},
+	} {
+		if got := test.filter.match(entry); got != test.want {
+			t.Errorf("%v: match %v", test.filter.where.list, got)
+		}
+	}
+	var out = string(log.Logfmt{UTC: true}.Encode(nil, entry))
+	if want := "ts=2024-05-01T09:40:00Z lvl=WARN log=db.query msg=\"slow query\" " +
+		"took=1.5 http.status=503 http.path=/api tags.0=a tags.1=b ok=false\n"; out != want {
+		t.Errorf("bad output: %q, want %q", out, want)
+	}
+	var l exprList
+	if err := l.Set("=value"); err == nil {
+		t.Error("expected error")
+	}
+	dec, err := decoder("auto", "15:04:05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode([]byte("12:30:00 ERROR [db]: failed n=1"), entry); err != nil ||
+		entry.Category != "db" || entry.Message != "failed" {
+		t.Errorf("bad console entry: %+v, %v", entry, err)
+	}
+	if err := dec.Decode([]byte("ts=2024-05-01T09:40:00Z lvl=INFO msg=ok"), entry); err != nil ||
+		entry.Message != "ok" {
+		t.Errorf("bad logfmt entry: %+v, %v", entry, err)
+	}
+	if err := dec.Decode([]byte("plain text"), entry); !errors.Is(err, log.ErrNotEntry) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
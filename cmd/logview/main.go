@@ -0,0 +1,294 @@
+// Команда logview выводит в удобном для чтения виде лог в формате JSON,
+// Logfmt или Console. Лог читается из указанных файлов или со стандартного
+// ввода и выводится в формате Color, Console, Logfmt или JSON. Записи
+// можно отфильтровать по уровню, разделу, времени и выражениям -where,
+// которые записываются так же, как в logquery.
+//
+//	logview -level warn -category db -since 1h -where 'status>=500' app.log
+//	tail -n 100 app.log | logview -format logfmt
+//
+// С параметром -f файлы отслеживаются, как в tail -f, и новые записи
+// выводятся по мере их появления. Сжатые с помощью gzip файлы
+// распаковываются, а в файлах, записанных через log.Compressor, с параметром
+// -since пропускаются блоки с более ранними записями.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdigger/log"
+	"github.com/mdigger/log/cmd/internal/expr"
+)
+
+func main() {
+	var (
+		format   = flag.String("format", "auto", "output `format`: auto, color, dev, console, logfmt or json")
+		level    = flag.String("level", "", "minimal `level` of entries")
+		category = flag.String("category", "", "category `prefix`")
+		since    = flag.String("since", "", "show entries after `time` (RFC 3339 or duration ago)")
+		until    = flag.String("until", "", "show entries before `time` (RFC 3339 or duration ago)")
+		grep     = flag.String("grep", "", "show entries with message containing `text`")
+		follow   = flag.Bool("f", false, "follow files as they grow")
+		utc      = flag.Bool("utc", false, "output time in UTC")
+		timeFmt  = flag.String("time", "", "time `layout` for text formats")
+		input    = flag.String("input", "auto", "input `format`: auto, json, logfmt or console")
+		inTime   = flag.String("input-time", "2006-01-02 15:04:05", "time `layout` of console input")
+		match    filter
+	)
+	flag.Var(&match.where, "where", "filter `expression` as in logquery (may be repeated)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file ...]\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	if *level != "" {
+		if match.level, err = log.ParseLevel(*level); err != nil {
+			fatal(err)
+		}
+		match.hasLevel = true
+	}
+	match.category = *category
+	match.message = *grep
+	if *since != "" {
+		if match.since, err = expr.ParseTime(*since); err != nil {
+			fatal(err)
+		}
+	}
+	if *until != "" {
+		if match.until, err = expr.ParseTime(*until); err != nil {
+			fatal(err)
+		}
+	}
+	enc, err := encoder(*format, *timeFmt, *utc)
+	if err != nil {
+		fatal(err)
+	}
+	dec, err := decoder(*input, *inTime)
+	if err != nil {
+		fatal(err)
+	}
+	var out = &printer{
+		w:      bufio.NewWriter(os.Stdout),
+		enc:    enc,
+		dec:    dec,
+		filter: &match,
+		flush:  *follow,
+	}
+	defer out.w.Flush()
+
+	var files = flag.Args()
+	if len(files) == 0 {
+		if err := out.read(os.Stdin, *follow); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, len(files))
+	)
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			fatal(err)
+		}
+		defer file.Close()
+		if !*follow { // файлы выводим по очереди
+			r, err := uncompress(file, match.since)
+			if err != nil {
+				fatal(fmt.Errorf("%s: %w", name, err))
+			}
+			if err := out.read(r, false); err != nil {
+				fatal(fmt.Errorf("%s: %w", name, err))
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(name string, file *os.File) {
+			defer wg.Done()
+			if err := out.read(file, true); err != nil {
+				errs <- fmt.Errorf("%s: %w", name, err)
+			}
+		}(name, file)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		fatal(err)
+	}
+}
+
+// uncompress возвращает поток для чтения записей из файла. Сжатые с помощью
+// gzip файлы распаковываются, а для файлов, записанных log.Compressor,
+// блоки до времени since пропускаются без распаковки.
+func uncompress(file *os.File, since time.Time) (io.Reader, error) {
+	var r = bufio.NewReader(file)
+	magic, err := r.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return r, nil
+	}
+	if !since.IsZero() {
+		if info, err := file.Stat(); err == nil {
+			if blocks, err := log.SeekBlocks(file, info.Size(), since); err == nil {
+				return blocks, nil
+			}
+		}
+	}
+	return gzip.NewReader(r)
+}
+
+// fatal выводит описание ошибки и завершает программу.
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "logview:", err)
+	os.Exit(1)
+}
+
+// encoder возвращает формат вывода с указанным названием.
+func encoder(name, layout string, utc bool) (log.Encoder, error) {
+	if name == "auto" {
+		name = "console"
+		if log.ColorEnabled(os.Stdout) {
+			name = "color"
+		}
+	}
+	switch name {
+	case "color":
+		return &log.Color{TimeFormat: layout, UTC: utc}, nil
+	case "dev":
+		return &log.Color{KeyIndent: 8, NewLine: true, TimeFormat: layout,
+			UTC: utc}, nil
+	case "console", "std":
+		if layout == "" {
+			layout = "2006-01-02 15:04:05"
+		}
+		return &log.Console{TimeFormat: layout, UTC: utc}, nil
+	case "logfmt":
+		return &log.Logfmt{TimeFormat: layout, UTC: utc}, nil
+	case "json":
+		return new(log.JSON), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", name)
+	}
+}
+
+// decoder возвращает формат разбора входных данных с указанным названием.
+func decoder(name, layout string) (log.Decoder, error) {
+	switch name {
+	case "auto":
+		return log.AutoDecoder{Console: log.Console{TimeFormat: layout}}, nil
+	case "json":
+		return log.JSON{}, nil
+	case "logfmt":
+		return log.Logfmt{}, nil
+	case "console", "std":
+		return log.Console{TimeFormat: layout}, nil
+	default:
+		return nil, fmt.Errorf("unknown input format %q", name)
+	}
+}
+
+// pollInterval задает интервал проверки появления новых данных при
+// отслеживании файлов.
+const pollInterval = 250 * time.Millisecond
+
+// printer выводит записи лога, прочитанные из потоков.
+type printer struct {
+	mu     sync.Mutex
+	w      *bufio.Writer // поток для вывода
+	enc    log.Encoder   // формат вывода
+	dec    log.Decoder   // формат разбора
+	filter *filter       // фильтр записей
+	flush  bool          // сбрасывать буфер после каждой записи
+	buf    []byte        // буфер для формирования записи
+	entry  log.Entry     // разобранная запись
+}
+
+// read читает записи из потока и выводит их. Если задан follow, то после
+// окончания данных чтение продолжается по мере их появления.
+func (p *printer) read(r io.Reader, follow bool) error {
+	var (
+		br   = bufio.NewReader(r)
+		line []byte
+	)
+	for {
+		chunk, err := br.ReadSlice('\n')
+		line = append(line, chunk...)
+		switch err {
+		case nil:
+			p.print(line)
+			line = line[:0]
+		case bufio.ErrBufferFull: // длинная строка: читаем дальше
+		case io.EOF:
+			if !follow {
+				if len(line) > 0 {
+					p.print(line)
+				}
+				return nil
+			}
+			time.Sleep(pollInterval) // ждем окончания строки
+		default:
+			return err
+		}
+	}
+}
+
+// print выводит строку лога, если она соответствует фильтру. Строки, не
+// являющиеся записями лога, выводятся как есть, если не заданы условия
+// фильтрации.
+func (p *printer) print(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	line = bytes.TrimRight(line, "\r\n")
+	err := p.dec.Decode(line, &p.entry)
+	switch {
+	case err != nil:
+		if !p.filter.empty() {
+			return
+		}
+		p.w.Write(line)
+		p.w.WriteByte('\n')
+	case p.filter.match(&p.entry):
+		p.buf = p.enc.Encode(p.buf[:0], &p.entry)
+		p.w.Write(p.buf)
+	default:
+		return
+	}
+	if p.flush {
+		p.w.Flush()
+	}
+}
+
+// exprList поддерживает задание нескольких выражений для отбора записей.
+// Запись должна удовлетворять всем выражениям.
+type exprList struct {
+	list  []string    // выражения в исходном виде
+	exprs []expr.Expr // разобранные выражения
+}
+
+// String поддерживает интерфейс flag.Value.
+func (l *exprList) String() string {
+	return strings.Join(l.list, ",")
+}
+
+// Set поддерживает интерфейс flag.Value.
+func (l *exprList) Set(s string) error {
+	e, err := expr.Parse(s)
+	if err != nil {
+		return err
+	}
+	l.list = append(l.list, s)
+	l.exprs = append(l.exprs, e)
+	return nil
+}
@@ -2,159 +2,359 @@ package log
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"time"
 )
 
 // Color выводит лог в более удобном для чтения в консоли виде, используя
-// цветовые выделения и помещая параметры на новую строку.
+// цветовые выделения и помещая параметры на новую строку. Цвета задаются
+// цветовой схемой Theme, а если задан Plain, то лог выводится без цветового
+// выделения. Цветовое выделение также не используется, если оно запрещено
+// переменными окружения NO_COLOR или TERM=dumb и не включено FORCE_COLOR.
+// Управляющие символы в тексте экранируются, а многострочные сообщения
+// выводятся с отступом, если не задан Raw.
 type Color struct {
-	Levels    map[Level]string // переопределение строк для вывода уровня
-	KeyIndent int              // отступ от значения дополнительного параметра
-	NewLine   bool             // выводить атрибуты с новой строки
+	Levels     map[Level]string // переопределение строк для вывода уровня
+	KeyIndent  int              // отступ от значения дополнительного параметра
+	NewLine    bool             // выводить атрибуты с новой строки
+	TimeFormat string           // формат времени; по умолчанию 15:04:05.000000
+	UTC        bool             // вывод даты и времени в UTC
+	Theme      *Theme           // цветовая схема; по умолчанию DefaultTheme
+	Plain      bool             // выводить без цветового выделения
+	Raw        bool             // выводить текст без экранирования
 }
 
-// Encode форматирует в буфер запись лога для текстового консольного
-// представления.
-func (f Color) Encode(entry *Entry) []byte {
-	var buf = buffer(buffers.Get().([]byte)[:0]) // получаем и сбрасываем буфер
+// Encode добавляет к dst запись лога в текстовом консольном представлении и
+// возвращает результат.
+func (f Color) Encode(dst []byte, entry *Entry) []byte {
+	var buf = buffer(dst)
+	var theme = f.theme()
+	f.Plain = f.Plain || !colorAllowed()
 	// выводим время
 	if entry.Timestamp.IsZero() {
 		entry.Timestamp = time.Now()
 	}
-
-	buf.WriteString("\x1b[2m")
-	buf = entry.Timestamp.AppendFormat(buf, "15:04:05.000000")
-	buf.WriteString("\x1b[0m ")
+	var ts = entry.Timestamp
+	if f.UTC {
+		ts = ts.UTC()
+	}
+	var layout = f.TimeFormat
+	if layout == "" {
+		layout = "15:04:05.000000"
+	}
+	buf = f.start(buf, theme.Time)
+	buf = ts.AppendFormat(buf, layout)
+	buf = f.end(buf, theme.Time)
+	buf.WriteByte(' ')
 	// уровень записи
 	level, ok := f.Levels[entry.Level]
 	if !ok {
-		switch entry.Level & -32 {
-		case FATAL:
-			level = "FATAL"
-		case ERROR:
-			level = "ERROR"
-		case WARN:
-			level = "WARN "
-		case INFO:
-			level = "INFO "
-		case DEBUG:
-			level = "DEBUG"
-		case TRACE:
-			level = "TRACE"
-		default:
-			level = ""
-		}
+		level = entry.Level.String()
 	}
 	if level != "" {
-		buf.WriteString("\x1b[7m\x1b[")
-		switch entry.Level & -32 {
-		case FATAL:
-			buf.WriteString("35")
-		case ERROR:
-			buf.WriteString("91")
-		case WARN:
-			buf.WriteString("93")
-		case INFO:
-			buf.WriteString("92")
-		case DEBUG:
-			buf.WriteString("94")
-		case TRACE:
-			buf.WriteString("96")
-		default:
-			buf.WriteString("37")
+		var color, ok = theme.Levels[entry.Level.group()]
+		if !ok {
+			color = entry.Level.Info().Color
+		}
+		if !f.Plain && color != "" { // уровень выводим в инверсном цвете
+			buf.WriteString("\x1b[7;")
+			buf.WriteString(color)
+			buf.WriteByte('m')
 		}
-		buf.WriteByte('m')
 		buf.WriteString(level)
-		buf.WriteString("\x1b[0m ")
+		for i := len(level); i < 5; i++ {
+			buf.WriteByte(' ') // выравниваем короткие названия
+		}
+		buf = f.end(buf, color)
+		buf.WriteByte(' ')
 	}
 	// категория
 	if entry.Category != "" {
-		buf.WriteString("\x1b[2m[\x1b[0m\x1b[92m")
-		buf.WriteString(entry.Category)
-		buf.WriteString("\x1b[0m\x1b[2m]:\x1b[0m ")
+		buf = f.paint(buf, theme.Punct, "[")
+		buf = f.paint(buf, theme.Category, entry.Category)
+		buf = f.paint(buf, theme.Punct, "]:")
+		buf.WriteByte(' ')
 	}
 	// основной текст
 	if entry.Message != "" {
-		buf.WriteString(entry.Message)
+		buf = f.start(buf, theme.Message)
+		if f.Raw {
+			buf.WriteString(entry.Message)
+		} else { // продолжение сообщения выводим с отступом
+			buf = appendSafe(buf, entry.Message, "    ")
+		}
+		buf = f.end(buf, theme.Message)
 	}
 	// дополнительные поля
+	var newline = f.NewLine
 	for _, field := range entry.Fields {
-		if f.NewLine {
-			buf.WriteString("\n   ")
+		buf = f.appendField(buf, "", newline, field)
+		if _, ok := field.object(); ok && field.kind != groupKind {
+			newline = true // после блока выводим поля с новой строки
+		}
+	}
+	buf.WriteByte('\n')
+	return buf
+}
+
+// theme возвращает используемую цветовую схему.
+func (f Color) theme() *Theme {
+	if f.Theme != nil {
+		return f.Theme
+	}
+	return &DefaultTheme
+}
+
+// start добавляет в буфер начало выделения цветом.
+func (f Color) start(buf buffer, color string) buffer {
+	if f.Plain || color == "" {
+		return buf
+	}
+	buf.WriteString("\x1b[")
+	buf.WriteString(color)
+	buf.WriteByte('m')
+	return buf
+}
+
+// end добавляет в буфер окончание выделения цветом.
+func (f Color) end(buf buffer, color string) buffer {
+	if f.Plain || color == "" {
+		return buf
+	}
+	buf.WriteString("\x1b[0m")
+	return buf
+}
+
+// paint добавляет в буфер текст, выделенный цветом.
+func (f Color) paint(buf buffer, color, text string) buffer {
+	buf = f.start(buf, color)
+	buf = f.text(buf, text)
+	return f.end(buf, color)
+}
+
+// text добавляет в буфер текст, экранируя управляющие символы, если не задан
+// Raw.
+func (f Color) text(buf buffer, s string) buffer {
+	if f.Raw {
+		buf.WriteString(s)
+		return buf
+	}
+	return appendSafe(buf, s, "")
+}
+
+// appendField добавляет в буфер дополнительное поле. Поля вложенных
+// объектов выводятся блоком, каждое с новой строки и с отступом, а поля групп
+// в виде "group.key=value".
+func (f Color) appendField(buf buffer, indent string, newline bool,
+	field Field) buffer {
+	if group, ok := field.group(); ok { // поля группы выводим с ее именем
+		for _, sub := range group {
+			sub.Name = field.Name + "." + sub.Name
+			buf = f.appendField(buf, indent, newline, sub)
 		}
-		buf.WriteString(" \x1b[36m")
-		buf.WriteString(field.Name)
-		buf.WriteString("\x1b[0m")
-		for i := 0; i < f.KeyIndent-len(field.Name); i++ {
-			buf.WriteByte(' ')
+		return buf
+	}
+	if newline {
+		buf.WriteString("\n   ")
+		buf.WriteString(indent)
+	}
+	var theme = f.theme()
+	buf.WriteByte(' ')
+	buf = f.paint(buf, theme.Key, field.Name)
+	if obj, ok := field.object(); ok {
+		buf = f.paint(buf, theme.Punct, ":")
+		var enc = colorObject{enc: f, buf: buf, indent: indent + "  "}
+		obj.MarshalLogObject(&enc)
+		return enc.buf
+	}
+	for i := 0; i < f.KeyIndent-len(field.Name); i++ {
+		buf.WriteByte(' ')
+	}
+	buf = f.paint(buf, theme.Punct, "=")
+	if f.KeyIndent > 0 {
+		buf.WriteByte(' ')
+	}
+	return f.appendValue(buf, field)
+}
+
+// appendValue добавляет в буфер значение дополнительного поля. Вложенные
+// объекты и массивы в качестве значений выводятся в одну строку.
+func (f Color) appendValue(buf buffer, field Field) buffer {
+	var theme = f.theme()
+	if obj, ok := field.object(); ok {
+		var enc = colorObject{enc: f, buf: f.paint(buf, theme.Punct, "{"),
+			inline: true}
+		obj.MarshalLogObject(&enc)
+		return f.paint(enc.buf, theme.Punct, "}")
+	}
+	if arr, ok := field.array(); ok {
+		var enc = colorObject{enc: f, buf: f.paint(buf, theme.Punct, "["),
+			inline: true}
+		arr.MarshalLogArray(&enc)
+		return f.paint(enc.buf, theme.Punct, "]")
+	}
+	var color = theme.valueColor(field)
+	buf = f.start(buf, color)
+	buf = f.appendScalar(buf, field)
+	return f.end(buf, color)
+}
+
+// valueColor возвращает цвет для вывода значения поля в зависимости от его
+// типа.
+func (t *Theme) valueColor(field Field) string {
+	switch field.kind {
+	case stringKind, stringerKind:
+		return t.String
+	case int64Kind, uint64Kind, float64Kind, durationKind:
+		return t.Number
+	case boolKind:
+		return t.Bool
+	case timeKind:
+		return t.Time
+	case errorKind:
+		if field.Value == nil {
+			return t.Nil
 		}
-		buf.WriteString("\x1b[2m=\x1b[0m")
-		if f.KeyIndent > 0 {
-			buf.WriteByte(' ')
+		return t.Error
+	case objectKind:
+		return ""
+	}
+	switch field.Value.(type) {
+	case nil:
+		return t.Nil
+	case time.Duration:
+		return t.Number
+	case string, []byte, fmt.Stringer:
+		if _, ok := field.Value.(error); ok {
+			return t.Error
 		}
-		switch value := field.Value.(type) {
-		case nil:
-			buf.WriteString("nil")
-		case string:
-			buf.WriteString(value)
-		case error:
-			buf.WriteQuote(value.Error())
-		case bool:
-			buf = strconv.AppendBool(buf, value)
-		case int:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int8:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int16:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int32:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int64:
-			buf = strconv.AppendInt(buf, value, 10)
-		case uint:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint8:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint16:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint32:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint64:
-			buf = strconv.AppendUint(buf, value, 10)
-		case float32:
-			buf = strconv.AppendFloat(buf, float64(value), 'g', -1, 32)
-		case float64:
-			buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
-		case time.Time:
-			buf.WriteByte('"')
-			if !value.IsZero() {
-				buf = value.AppendFormat(buf, "2006-01-02 15:04:05")
-			}
-			buf.WriteByte('"')
-		case fmt.Stringer:
-			buf.WriteString(value.String())
-		default:
-			buf.WriteString(fmt.Sprint(value))
+		return t.String
+	case error:
+		return t.Error
+	case bool:
+		return t.Bool
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return t.Number
+	case time.Time:
+		return t.Time
+	default:
+		return ""
+	}
+}
+
+// appendScalar добавляет в буфер значение поля, не являющееся объектом или
+// массивом.
+func (f Color) appendScalar(buf buffer, field Field) buffer {
+	switch field.kind {
+	case stringKind:
+		return f.text(buf, field.str)
+	case int64Kind:
+		return strconv.AppendInt(buf, int64(field.num), 10)
+	case uint64Kind:
+		return strconv.AppendUint(buf, field.num, 10)
+	case float64Kind:
+		return strconv.AppendFloat(buf, math.Float64frombits(field.num), 'g', -1, 64)
+	case boolKind:
+		return strconv.AppendBool(buf, field.num != 0)
+	case durationKind:
+		buf.WriteString(time.Duration(field.num).String())
+		return buf
+	case timeKind:
+		buf.WriteByte('"')
+		if field.Value != nil {
+			buf = field.time().AppendFormat(buf, "2006-01-02 15:04:05")
 		}
+		buf.WriteByte('"')
+		return buf
+	case objectKind:
+		return f.text(buf, fmt.Sprint(field.Value))
+	}
+	// ошибки, fmt.Stringer и значения без указания типа
+	switch value := field.Value.(type) {
+	case nil:
+		buf.WriteString("nil")
+	case string:
+		buf = f.text(buf, value)
+	case error:
+		buf.WriteQuote(value.Error())
+	case bool:
+		buf = strconv.AppendBool(buf, value)
+	case int:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int8:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int16:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int32:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int64:
+		buf = strconv.AppendInt(buf, value, 10)
+	case uint:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint8:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint16:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint32:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint64:
+		buf = strconv.AppendUint(buf, value, 10)
+	case float32:
+		buf = strconv.AppendFloat(buf, float64(value), 'g', -1, 32)
+	case float64:
+		buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
+	case time.Time:
+		buf.WriteByte('"')
+		if !value.IsZero() {
+			buf = value.AppendFormat(buf, "2006-01-02 15:04:05")
+		}
+		buf.WriteByte('"')
+	case fmt.Stringer:
+		buf = f.text(buf, value.String())
+	default:
+		buf = f.text(buf, fmt.Sprint(value))
 	}
-	// // для ошибок выводим стек вызовов
-	// if entry.Level >= WARN {
-	// 	if entry.Stack == nil {
-	// 		entry.CallStack(1)
-	// 	}
-	// 	for _, src := range entry.Stack {
-	// 		buf = append(buf, "\n  \x1b[2m- "...)
-	// 		buf = append(buf, src.Pkg...)
-	// 		buf = append(buf, "/\x1b[0m"...)
-	// 		buf = append(buf, src.File...)
-	// 		buf = append(buf, "\x1b[2m:\x1b[0m"...)
-	// 		buf = strconv.AppendInt(buf, int64(src.Line), 10)
-	// 		buf = append(buf, " \x1b[2m(\x1b[0m\x1b[36m"...)
-	// 		buf = append(buf, src.Func...)
-	// 		buf = append(buf, "\x1b[0m\x1b[2m)\x1b[0m"...)
-	// 	}
-	// }
-	buf.WriteByte('\n')
 	return buf
 }
+
+// colorObject поддерживает вывод вложенных объектов и массивов с цветовым
+// выделением.
+type colorObject struct {
+	enc    Color  // формат вывода значений
+	buf    buffer // буфер для вывода
+	indent string // отступ для полей объекта
+	inline bool   // вывод в одну строку
+	n      int    // количество выведенных элементов
+}
+
+// Add добавляет поля объекта.
+func (o *colorObject) Add(fields ...Field) {
+	for _, field := range fields {
+		if !o.inline {
+			o.buf = o.enc.appendField(o.buf, o.indent, true, field)
+			continue
+		}
+		if o.n > 0 {
+			o.buf.WriteByte(' ')
+		}
+		var theme = o.enc.theme()
+		o.buf = o.enc.paint(o.buf, theme.Key, field.Name)
+		o.buf = o.enc.paint(o.buf, theme.Punct, "=")
+		o.buf = o.enc.appendValue(o.buf, field)
+		o.n++
+	}
+}
+
+// Append добавляет элементы массива.
+func (o *colorObject) Append(values ...Field) {
+	for _, value := range values {
+		if o.n > 0 {
+			o.buf = o.enc.paint(o.buf, o.enc.theme().Punct, ",")
+			o.buf.WriteByte(' ')
+		}
+		o.buf = o.enc.appendValue(o.buf, value)
+		o.n++
+	}
+}
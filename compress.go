@@ -0,0 +1,243 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Compressor описывает поток вывода лога, сжимающий записи с помощью gzip
+// независимыми блоками. Блок завершается и записывается в поток, когда
+// объем несжатых данных превышает заданный размер, когда с первой записи
+// блока прошло заданное время, или при вызове Flush. Поэтому при аварийном
+// завершении приложения теряется не больше одного незавершенного блока.
+//
+// Каждый блок является отдельным gzip-потоком, и файл целиком читается
+// gunzip, zcat или gzip.Reader. В заголовке блока сохраняются размер блока,
+// время первой и последней записи и их количество, что позволяет с помощью
+// ReadBlockIndex и SeekBlocks переходить к нужному времени без распаковки
+// всего файла.
+//
+// Поддерживается только формат gzip: других алгоритмов сжатия с блочной
+// структурой в стандартной библиотеке нет, а формат zstd потребовал бы
+// внешней зависимости.
+type Compressor struct {
+	mu       sync.Mutex
+	w        io.Writer
+	size     int           // размер несжатых данных блока
+	interval time.Duration // максимальное время до записи блока
+	gz       *gzip.Writer
+	buf      bytes.Buffer // сжатые данные блока
+	block    Block        // описание текущего блока
+	n        int          // размер несжатых данных текущего блока
+	timer    *time.Timer
+	err      error // ошибка записи блока по таймеру
+}
+
+// Block описывает блок сжатого лога.
+type Block struct {
+	Offset  int64     // смещение блока в файле
+	Size    int64     // размер сжатого блока
+	First   time.Time // время первой записи
+	Last    time.Time // время последней записи
+	Entries int       // количество записей
+}
+
+// Заголовок блока содержит дополнительное поле gzip с идентификатором "LB",
+// в котором сохраняются размер блока, время первой и последней записи в
+// наносекундах и количество записей.
+const (
+	blockExtraSize  = 28
+	blockHeaderSize = 16 + blockExtraSize // заголовок gzip с полем XLEN и подполем
+)
+
+// blockExtra содержит дополнительное поле заголовка блока до его заполнения.
+var blockExtra = append([]byte{'L', 'B', blockExtraSize, 0}, make([]byte, blockExtraSize)...)
+
+// ErrNoBlockIndex возвращается, если файл сжат не с помощью Compressor.
+var ErrNoBlockIndex = errors.New("log: no block index")
+
+// NewCompressor возвращает поток, сжимающий записи блоками по size байт
+// несжатых данных и записывающий блок не позже, чем через interval после
+// первой записи в нем. Если параметры не больше нуля, то используются 1 МБ
+// и 1 секунда.
+func NewCompressor(w io.Writer, size int, interval time.Duration) *Compressor {
+	if size <= 0 {
+		size = 1 << 20
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	var c = &Compressor{w: w, size: size, interval: interval}
+	c.gz = gzip.NewWriter(&c.buf)
+	return c
+}
+
+// Write добавляет запись в текущий блок. Если ранее не удалось записать
+// блок по таймеру, то возвращается эта ошибка.
+func (c *Compressor) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.err; err != nil {
+		c.err = nil
+		return 0, err
+	}
+	var now = time.Now()
+	if c.n == 0 {
+		c.buf.Reset()
+		c.gz.Reset(&c.buf)
+		c.gz.Header.Extra = blockExtra
+		c.block = Block{First: now}
+		if c.timer == nil {
+			c.timer = time.AfterFunc(c.interval, c.timeout)
+		} else {
+			c.timer.Reset(c.interval)
+		}
+	}
+	if _, err := c.gz.Write(p); err != nil {
+		return 0, err
+	}
+	c.n += len(p)
+	c.block.Last = now
+	c.block.Entries++
+	if c.n >= c.size {
+		if err := c.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// timeout записывает блок по истечении времени.
+func (c *Compressor) timeout() {
+	c.mu.Lock()
+	if err := c.flush(); err != nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+}
+
+// flush завершает текущий блок и записывает его в поток.
+func (c *Compressor) flush() error {
+	if c.n == 0 {
+		return nil
+	}
+	c.n = 0
+	c.timer.Stop()
+	if err := c.gz.Close(); err != nil {
+		return err
+	}
+	var data = c.buf.Bytes()
+	var extra = data[16:blockHeaderSize]
+	binary.LittleEndian.PutUint64(extra, uint64(len(data)))
+	binary.LittleEndian.PutUint64(extra[8:], uint64(c.block.First.UnixNano()))
+	binary.LittleEndian.PutUint64(extra[16:], uint64(c.block.Last.UnixNano()))
+	binary.LittleEndian.PutUint32(extra[24:], uint32(c.block.Entries))
+	_, err := c.w.Write(data)
+	return err
+}
+
+// Flush записывает текущий блок в поток.
+func (c *Compressor) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+// Sync записывает текущий блок и сбрасывает буферизованные данные потока,
+// если он поддерживает метод Flush или Sync.
+func (c *Compressor) Sync() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.flush(); err != nil {
+		return err
+	}
+	switch w := c.w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Sync() error }:
+		return w.Sync()
+	}
+	return nil
+}
+
+// Close записывает текущий блок и останавливает таймер. Поток, в который
+// выполняется запись, не закрывается.
+func (c *Compressor) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err = c.flush()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	return err
+}
+
+// ReadBlockIndex читает заголовки блоков файла, записанного с помощью
+// Compressor, не распаковывая их. Если файл сжат без индекса блоков, то
+// возвращается ErrNoBlockIndex. Если последний блок записан не полностью,
+// то возвращаются предшествующие ему блоки и io.ErrUnexpectedEOF.
+func ReadBlockIndex(r io.ReaderAt, size int64) ([]Block, error) {
+	var (
+		blocks []Block
+		header [blockHeaderSize]byte
+	)
+	for offset := int64(0); offset < size; {
+		n, err := r.ReadAt(header[:], offset)
+		if err != nil && err != io.EOF {
+			return blocks, err
+		}
+		if n >= 16 && (header[0] != 0x1f || header[1] != 0x8b ||
+			header[3]&0x04 == 0 || !bytes.Equal(header[12:16], blockExtra[:4])) {
+			return blocks, ErrNoBlockIndex
+		}
+		if n < len(header) {
+			return blocks, io.ErrUnexpectedEOF
+		}
+		var extra = header[16:]
+		var block = Block{
+			Offset:  offset,
+			Size:    int64(binary.LittleEndian.Uint64(extra)),
+			First:   time.Unix(0, int64(binary.LittleEndian.Uint64(extra[8:]))),
+			Last:    time.Unix(0, int64(binary.LittleEndian.Uint64(extra[16:]))),
+			Entries: int(binary.LittleEndian.Uint32(extra[24:])),
+		}
+		if block.Size < blockHeaderSize {
+			return blocks, ErrNoBlockIndex
+		}
+		if offset+block.Size > size {
+			return blocks, io.ErrUnexpectedEOF
+		}
+		blocks = append(blocks, block)
+		offset += block.Size
+	}
+	return blocks, nil
+}
+
+// SeekBlocks возвращает распакованные данные файла, записанного с помощью
+// Compressor, начиная с первого блока, который может содержать записи не
+// раньше t. Блоки до него не читаются.
+func SeekBlocks(r io.ReaderAt, size int64, t time.Time) (io.Reader, error) {
+	blocks, err := ReadBlockIndex(r, size)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	var i = sort.Search(len(blocks), func(i int) bool {
+		return !blocks[i].Last.Before(t)
+	})
+	var offset int64
+	if i < len(blocks) {
+		offset = blocks[i].Offset
+	} else if i > 0 { // остается только недописанный блок
+		offset = blocks[i-1].Offset + blocks[i-1].Size
+	}
+	if offset == size { // записей после t нет
+		return bytes.NewReader(nil), nil
+	}
+	return gzip.NewReader(io.NewSectionReader(r, offset, size-offset))
+}
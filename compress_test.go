@@ -0,0 +1,77 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressor(t *testing.T) {
+	var out = new(bytes.Buffer)
+	var c = NewCompressor(out, 64, time.Hour)
+	var log = NewWriter(c, INFO, new(JSON))
+	log.Info("first block", "n", 1)
+	log.Info("first block", "n", 2) // превышает размер блока
+	var mid = time.Now()
+	log.Info("second block")
+	if err := log.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	gz, err := gzip.NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil || strings.Count(string(data), "\n") != 3 {
+		t.Fatalf("bad data: %q %v", data, err)
+	}
+	var r = bytes.NewReader(out.Bytes())
+	blocks, err := ReadBlockIndex(r, r.Size())
+	if err != nil || len(blocks) != 2 || blocks[0].Entries != 2 || blocks[1].Entries != 1 ||
+		blocks[1].Offset != blocks[0].Size || blocks[0].First.After(blocks[0].Last) {
+		t.Fatalf("bad index: %+v %v", blocks, err)
+	}
+	seek, err := SeekBlocks(r, r.Size(), mid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(seek); !strings.Contains(string(data), "second block") ||
+		strings.Contains(string(data), "first block") {
+		t.Errorf("bad seek data: %q", data)
+	}
+	// недописанный блок
+	if blocks, err := ReadBlockIndex(r, r.Size()-1); err != io.ErrUnexpectedEOF ||
+		len(blocks) != 1 {
+		t.Errorf("truncated block: %d %v", len(blocks), err)
+	}
+	var plain = new(bytes.Buffer)
+	gw := gzip.NewWriter(plain)
+	gw.Write([]byte("text\n"))
+	gw.Close()
+	if _, err := ReadBlockIndex(bytes.NewReader(plain.Bytes()),
+		int64(plain.Len())); err != ErrNoBlockIndex {
+		t.Errorf("plain gzip: %v", err)
+	}
+
+	// запись блока по таймеру
+	out.Reset()
+	c = NewCompressor(out, 0, 10*time.Millisecond)
+	defer c.Close()
+	c.Write([]byte("tick\n"))
+	var flushed = func() bool {
+		c.mu.Lock() // запись в поток выполняется с блокировкой
+		defer c.mu.Unlock()
+		return out.Len() > 0
+	}
+	for i := 0; i < 100 && !flushed(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !flushed() {
+		t.Error("block not flushed by timer")
+	}
+}
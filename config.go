@@ -0,0 +1,299 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config описывает настройки всей цепочки вывода лога: несколько потоков
+// вывода со своими форматами и уровнями, ограничение количества одинаковых
+// записей и скрытие значений полей. Настройки, заданные на верхнем уровне,
+// используются для всех потоков вывода, если не переопределены в них.
+// Настройки задаются только в формате JSON: поддержка YAML или TOML
+// потребовала бы внешних зависимостей.
+//
+//	{
+//	  "level": "info",
+//	  "categories": {"db": "debug"},
+//	  "redact": ["password", "token"],
+//	  "sampling": {"tick": "1s", "first": 100, "thereafter": 10},
+//	  "outputs": [
+//	    {"path": "stderr", "format": "color"},
+//	    {"path": "/var/log/app.log", "format": "json", "level": "debug"}
+//	  ]
+//	}
+type Config struct {
+	Level      string            `json:"level,omitempty"`      // минимальный уровень
+	Categories map[string]string `json:"categories,omitempty"` // уровни разделов
+	Redact     []string          `json:"redact,omitempty"`     // скрываемые поля
+	Sampling   *SamplingConfig   `json:"sampling,omitempty"`   // ограничение записей
+	Outputs    []OutputConfig    `json:"outputs"`              // потоки вывода
+}
+
+// OutputConfig описывает настройки потока вывода лога.
+type OutputConfig struct {
+	Path       string            `json:"path"`                 // stderr, stdout или имя файла
+	Format     string            `json:"format,omitempty"`     // console, color, dev, auto, logfmt или json
+	Level      string            `json:"level,omitempty"`      // минимальный уровень
+	Categories map[string]string `json:"categories,omitempty"` // уровни разделов
+	TimeFormat string            `json:"time,omitempty"`       // формат времени для текстовых форматов
+	UTC        bool              `json:"utc,omitempty"`        // время в UTC для текстовых форматов
+}
+
+// SamplingConfig описывает ограничение количества одинаковых записей.
+// Подробнее смотри описание Sampler.
+type SamplingConfig struct {
+	Tick       string `json:"tick"`                 // интервал, например "1s"
+	First      int    `json:"first"`                // первые записи в интервале
+	Thereafter int    `json:"thereafter,omitempty"` // затем каждая n-я запись
+}
+
+// ParseConfig разбирает настройки лога в формате JSON и проверяет их.
+// Другие форматы не поддерживаются и возвращают ошибку разбора JSON.
+func ParseConfig(data []byte) (*Config, error) {
+	var config = new(Config)
+	var dec = json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line, col := position(data, syntax.Offset)
+			return nil, fmt.Errorf("log config: invalid JSON at line %d, column %d: %v",
+				line, col, err)
+		}
+		return nil, fmt.Errorf("log config: invalid JSON: %v", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadConfig читает настройки лога из файла в формате JSON.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return config, nil
+}
+
+// position возвращает номер строки и колонки для смещения в данных.
+// Смещение ошибки разбора JSON указывает на следующий за ошибочным байт.
+func position(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset > 0 {
+		offset-- // ошибочный байт
+	}
+	line = 1 + bytes.Count(data[:offset], []byte{'\n'})
+	col = int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return line, col
+}
+
+// Validate проверяет настройки и возвращает ошибку с указанием
+// некорректного параметра.
+func (c *Config) Validate() error {
+	var errs []string
+	var check = func(name string, err error) {
+		if err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+	check("level", checkLevel(c.Level))
+	for name, lvl := range c.Categories {
+		check("categories."+name, checkLevel(lvl))
+	}
+	if c.Sampling != nil {
+		_, err := c.Sampling.tick()
+		check("sampling.tick", err)
+		switch {
+		case c.Sampling.First < 0 || c.Sampling.Thereafter < 0:
+			check("sampling", errors.New("negative count"))
+		case c.Sampling.First == 0 && c.Sampling.Thereafter == 0:
+			check("sampling", errors.New("first and thereafter are zero: all entries dropped"))
+		}
+	}
+	if len(c.Outputs) == 0 {
+		check("outputs", errors.New("no outputs defined"))
+	}
+	for i, out := range c.Outputs {
+		var prefix = fmt.Sprintf("outputs[%d].", i)
+		if out.Path == "" {
+			check(prefix+"path", errors.New("empty path"))
+		}
+		_, err := out.encoder(nil)
+		check(prefix+"format", err)
+		check(prefix+"level", checkLevel(out.Level))
+		for name, lvl := range out.Categories {
+			check(prefix+"categories."+name, checkLevel(lvl))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("log config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// checkLevel проверяет название уровня. Пустое название допустимо.
+func checkLevel(name string) error {
+	if name == "" {
+		return nil
+	}
+	_, err := ParseLevel(name)
+	return err
+}
+
+// tick возвращает интервал ограничения записей.
+func (s *SamplingConfig) tick() (time.Duration, error) {
+	d, err := time.ParseDuration(s.Tick)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("invalid duration %q", s.Tick)
+	}
+	return d, err
+}
+
+// encoder возвращает формат вывода для потока w. Формат auto выбирает
+// color при выводе в терминал и console в остальных случаях.
+func (o *OutputConfig) encoder(w io.Writer) (Encoder, error) {
+	var format = strings.ToLower(o.Format)
+	if format == "auto" {
+		format = "console"
+		if ColorEnabled(w) {
+			format = "color"
+		}
+	}
+	switch format {
+	case "", "console", "std":
+		var timeFormat = o.TimeFormat
+		if timeFormat == "" {
+			timeFormat = "2006-01-02 15:04:05"
+		}
+		return &Console{TimeFormat: timeFormat, UTC: o.UTC}, nil
+	case "color":
+		return &Color{TimeFormat: o.TimeFormat, UTC: o.UTC,
+			Plain: !colorAllowed()}, nil
+	case "dev":
+		return &Color{KeyIndent: 8, NewLine: true, TimeFormat: o.TimeFormat,
+			UTC: o.UTC, Plain: !colorAllowed()}, nil
+	case "json":
+		return new(JSON), nil
+	case "logfmt":
+		return &Logfmt{TimeFormat: o.TimeFormat, UTC: o.UTC}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", o.Format)
+	}
+}
+
+// Pipeline описывает цепочку обработчиков лога, созданную по настройкам.
+type Pipeline struct {
+	Handler
+	Writers []*Writer   // обработчики потоков вывода
+	closers []io.Closer // открытые файлы
+}
+
+// Enabled поддерживает интерфейс Enabler.
+func (p *Pipeline) Enabled(lvl Level, category string) bool {
+	return enabled(p.Handler, lvl, category)
+}
+
+// Build создает цепочку обработчиков лога по настройкам. Файлы для вывода
+// открываются на добавление и закрываются методом Close.
+func (c *Config) Build() (*Pipeline, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var p = new(Pipeline)
+	var handlers = make([]Handler, 0, len(c.Outputs))
+	for i, out := range c.Outputs {
+		var w io.Writer
+		switch out.Path {
+		case "stderr":
+			w = os.Stderr
+		case "stdout":
+			w = os.Stdout
+		default:
+			file, err := os.OpenFile(out.Path,
+				os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if err != nil {
+				p.Close()
+				return nil, fmt.Errorf("log config: outputs[%d].path: %v", i, err)
+			}
+			p.closers = append(p.closers, file)
+			w = file
+		}
+		enc, _ := out.encoder(w)
+		var writer = NewWriter(w, INFO, enc)
+		writer.update(func(state *writerState) error {
+			if err := state.set(c.Level); err != nil {
+				return err
+			}
+			if err := state.set(out.Level); err != nil {
+				return err
+			}
+			return state.setCategories(c.Categories, out.Categories)
+		})
+		if len(c.Redact) > 0 {
+			writer.AddHook(Redact(c.Redact...))
+		}
+		p.Writers = append(p.Writers, writer)
+		handlers = append(handlers, writer)
+	}
+	p.Handler = handlers[0]
+	if len(handlers) > 1 {
+		p.Handler = Multi(handlers...)
+	}
+	if c.Sampling != nil {
+		tick, _ := c.Sampling.tick()
+		p.Handler = NewSampler(p.Handler, tick, c.Sampling.First,
+			c.Sampling.Thereafter)
+	}
+	return p, nil
+}
+
+// setCategories устанавливает уровни для разделов лога. Последующие списки
+// переопределяют значения предыдущих.
+func (s *writerState) setCategories(lists ...map[string]string) error {
+	for _, list := range lists {
+		for name, lvl := range list {
+			if err := s.set(name + "=" + lvl); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush сбрасывает буферизованные записи всех потоков вывода.
+func (p *Pipeline) Flush() error {
+	var result error
+	for _, w := range p.Writers {
+		if err := w.Flush(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// Close закрывает открытые для вывода лога файлы.
+func (p *Pipeline) Close() error {
+	var result error
+	for _, c := range p.closers {
+		if err := c.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	p.closers = nil
+	return result
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ConfigHandler возвращает обработчик HTTP-запросов для просмотра и изменения
+// настроек лога во время работы приложения. Запрос GET возвращает текущие
+// настройки в формате, используемом Set. Запросы PUT и POST изменяют
+// настройки: новые параметры передаются в теле запроса в том же формате.
+// Если в запросе указан параметр "for" с длительностью ("?for=10m"), то
+// изменения действуют только указанное время.
+//
+// Обработчик не проверяет права доступа, а изменение настроек позволяет
+// включить вывод отладочных записей с конфиденциальными данными или
+// переполнить диск. Поэтому его следует подключать только за
+// аутентификацией или на адресе, недоступном извне.
+func (h *Writer) ConfigHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut, http.MethodPost:
+			data, err := io.ReadAll(io.LimitReader(r.Body, 4<<10))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var opt = strings.TrimSpace(string(data))
+			if value := r.URL.Query().Get("for"); value != "" {
+				var d time.Duration
+				if d, err = time.ParseDuration(value); err == nil {
+					err = h.SetFor(opt, d)
+				}
+			} else {
+				err = h.Set(opt)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, h.String()+"\n")
+	})
+}
+
+// ConfigHandler возвращает обработчик HTTP-запросов для просмотра и изменения
+// настроек лога по умолчанию. Как и Writer.ConfigHandler, его следует
+// подключать только за аутентификацией.
+func ConfigHandler() http.Handler {
+	return h.ConfigHandler()
+}
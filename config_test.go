@@ -0,0 +1,74 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	for _, test := range []struct {
+		data, err string
+	}{
+		{`{"outputs": [{"path": "stderr"}]`, "invalid JSON: unexpected EOF"},
+		{"{\n\"outputs\": [{\"path\": \"stderr\",}]}", "invalid JSON at line 2, column 31"},
+		{`{"outputs": [{"path": "stderr", "colour": true}]}`, `unknown field "colour"`},
+		{"level: info\noutputs:\n  - path: stderr\n", "invalid JSON at line 1, column 1"},
+		{`{"level": "loud", "outputs": [{"path": ""}, {"path": "x", "format": "xml"}]}`,
+			`level: unknown log level "loud"; outputs[0].path: empty path; outputs[1].format: unknown format "xml"`},
+		{`{"sampling": {"tick": "1"}, "outputs": [{"path": "stderr"}]}`, `sampling.tick: time: missing unit`},
+		{`{"sampling": {"first": 0}, "outputs": [{"path": "stderr"}]}`, `sampling: first and thereafter are zero`},
+	} {
+		_, err := ParseConfig([]byte(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("unexpected error: %v, want %q", err, test.err)
+		}
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir := t.TempDir()
+	var (
+		config  = filepath.Join(dir, "log.json")
+		logfile = filepath.Join(dir, "app.log")
+	)
+	write := func(data string) {
+		if err := os.WriteFile(config, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"level": "info", "redact": ["password"], "outputs": [
+		{"path": "` + logfile + `", "format": "console", "time": "-", "categories": {"db": "debug"}}]}`)
+	r, err := WatchConfig(config, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := NewLogger(r)
+	log.Debug("skipped")
+	log.New("db").Debug("query", "password", "secret")
+	write(`{"outputs": [{"path": "` + logfile + `", "format": "json"}]}`)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("reloaded")
+	write(`{"outputs": []}`)
+	if err := r.Reload(); err == nil {
+		t.Error("expected error")
+	}
+	log.Warn("kept")
+	r.Close()
+	if err := r.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+	data, err := os.ReadFile(logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || lines[0] != `- DEBUG [db]: query password="***"` ||
+		!strings.HasSuffix(lines[1], `"msg":"reloaded"}`) ||
+		!strings.HasSuffix(lines[2], `"msg":"kept"}`) {
+		t.Errorf("unexpected output:\n%s", data)
+	}
+}
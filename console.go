@@ -2,21 +2,26 @@ package log
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"time"
 )
 
-// Console поддерживает текстовое представление лога.
+// Console поддерживает текстовое представление лога. Управляющие символы в
+// сообщении, названии раздела, именах и значениях полей экранируются, поэтому
+// каждая запись всегда занимает одну строку. Если все данные лога получены из
+// доверенных источников, то экранирование можно отключить с помощью Raw.
 type Console struct {
 	TimeFormat string           // формат вывода даты и времени
 	UTC        bool             // вывод даты и времени в UTC
 	Levels     map[Level]string // переопределение строк для вывода уровня
+	Raw        bool             // выводить текст без экранирования
 }
 
-// Encode форматирует в буфер запись лога для текстового консольного
-// представления.
-func (f Console) Encode(entry *Entry) []byte {
-	var buf = buffer(buffers.Get().([]byte)[:0]) // получаем и сбрасываем буфер
+// Encode добавляет к dst запись лога в текстовом консольном представлении и
+// возвращает результат.
+func (f Console) Encode(dst []byte, entry *Entry) []byte {
+	var buf = buffer(dst)
 	// выводим дату и время, если задан формат
 	if f.TimeFormat != "" {
 		if entry.Timestamp.IsZero() {
@@ -41,65 +46,175 @@ func (f Console) Encode(entry *Entry) []byte {
 	// категория
 	if entry.Category != "" {
 		buf.WriteByte('[')
-		buf.WriteString(entry.Category)
+		buf = f.text(buf, entry.Category)
 		buf.WriteString("]: ")
 	}
 	// основной текст
 	if entry.Message != "" {
-		buf.WriteString(entry.Message)
+		buf = f.text(buf, entry.Message)
 	}
 	// дополнительные поля
 	for _, field := range entry.Fields {
-		buf.WriteByte(' ')
-		buf.WriteString(field.Name)
-		buf.WriteByte('=')
-		switch value := field.Value.(type) {
-		case nil:
-			buf.WriteString("nil")
-		case string:
-			buf.WriteQuote(value)
-		case []byte:
-			buf = strconv.AppendQuoteToGraphic(buf, string(value))
-		case error:
-			buf.WriteQuote(value.Error())
-		case bool:
-			buf = strconv.AppendBool(buf, value)
-		case int:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int8:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int16:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int32:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int64:
-			buf = strconv.AppendInt(buf, value, 10)
-		case uint:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint8:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint16:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint32:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint64:
-			buf = strconv.AppendUint(buf, value, 10)
-		case float32:
-			buf = strconv.AppendFloat(buf, float64(value), 'g', -1, 32)
-		case float64:
-			buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
-		case time.Time:
-			buf.WriteByte('"')
-			if !value.IsZero() {
-				buf = value.AppendFormat(buf, "2006-01-02 15:04:05")
-			}
-			buf.WriteByte('"')
-		case fmt.Stringer:
-			buf.WriteQuote(value.String())
-		default:
-			buf.WriteString(fmt.Sprint(value))
-		}
+		buf = f.appendField(buf, "", field)
 	}
 	buf.WriteByte('\n')
 	return buf
 }
+
+// appendField добавляет в буфер дополнительное поле. Поля вложенных
+// объектов выводятся отдельными парами, к имени которых добавляется префикс с
+// именем объекта.
+func (f Console) appendField(buf buffer, prefix string, field Field) buffer {
+	if obj, ok := field.object(); ok {
+		var enc = consoleObject{enc: f, buf: buf, prefix: prefix + field.Name + "."}
+		obj.MarshalLogObject(&enc)
+		return enc.buf
+	}
+	buf.WriteByte(' ')
+	buf = f.text(buf, prefix)
+	buf = f.text(buf, field.Name)
+	buf.WriteByte('=')
+	return f.appendValue(buf, field)
+}
+
+// appendValue добавляет в буфер значение дополнительного поля. Вложенные
+// объекты и массивы выводятся в фигурных и квадратных скобках.
+func (f Console) appendValue(buf buffer, field Field) buffer {
+	if obj, ok := field.object(); ok {
+		var enc = consoleObject{enc: f, buf: buf, inline: true}
+		enc.buf.WriteByte('{')
+		obj.MarshalLogObject(&enc)
+		enc.buf.WriteByte('}')
+		return enc.buf
+	}
+	if arr, ok := field.array(); ok {
+		var enc = consoleObject{enc: f, buf: buf, inline: true}
+		enc.buf.WriteByte('[')
+		arr.MarshalLogArray(&enc)
+		enc.buf.WriteByte(']')
+		return enc.buf
+	}
+	switch field.kind {
+	case stringKind:
+		buf.WriteQuote(field.str)
+		return buf
+	case int64Kind:
+		return strconv.AppendInt(buf, int64(field.num), 10)
+	case uint64Kind:
+		return strconv.AppendUint(buf, field.num, 10)
+	case float64Kind:
+		return strconv.AppendFloat(buf, math.Float64frombits(field.num), 'g', -1, 64)
+	case boolKind:
+		return strconv.AppendBool(buf, field.num != 0)
+	case durationKind:
+		buf.WriteString(time.Duration(field.num).String())
+		return buf
+	case timeKind:
+		buf.WriteByte('"')
+		if field.Value != nil {
+			buf = field.time().AppendFormat(buf, "2006-01-02 15:04:05")
+		}
+		buf.WriteByte('"')
+		return buf
+	case objectKind:
+		return f.text(buf, fmt.Sprint(field.Value))
+	}
+	// ошибки, fmt.Stringer и значения без указания типа
+	switch value := field.Value.(type) {
+	case nil:
+		buf.WriteString("nil")
+	case string:
+		buf.WriteQuote(value)
+	case []byte:
+		buf = strconv.AppendQuoteToGraphic(buf, string(value))
+	case error:
+		buf.WriteQuote(value.Error())
+	case bool:
+		buf = strconv.AppendBool(buf, value)
+	case int:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int8:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int16:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int32:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int64:
+		buf = strconv.AppendInt(buf, value, 10)
+	case uint:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint8:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint16:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint32:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint64:
+		buf = strconv.AppendUint(buf, value, 10)
+	case float32:
+		buf = strconv.AppendFloat(buf, float64(value), 'g', -1, 32)
+	case float64:
+		buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
+	case time.Duration:
+		buf.WriteString(value.String())
+	case time.Time:
+		buf.WriteByte('"')
+		if !value.IsZero() {
+			buf = value.AppendFormat(buf, "2006-01-02 15:04:05")
+		}
+		buf.WriteByte('"')
+	case fmt.Stringer:
+		buf.WriteQuote(value.String())
+	default:
+		buf = f.text(buf, fmt.Sprint(value))
+	}
+	return buf
+}
+
+// text добавляет в буфер текст, экранируя управляющие символы, если не задан
+// Raw.
+func (f Console) text(buf buffer, s string) buffer {
+	if f.Raw {
+		buf.WriteString(s)
+		return buf
+	}
+	return appendSafe(buf, s, "")
+}
+
+// consoleObject поддерживает вывод вложенных объектов и массивов в текстовом
+// виде.
+type consoleObject struct {
+	enc    Console // формат вывода значений
+	buf    buffer  // буфер для вывода
+	prefix string  // префикс имен полей
+	inline bool    // вывод в скобках, а не отдельными парами
+	n      int     // количество выведенных элементов
+}
+
+// Add добавляет поля объекта.
+func (o *consoleObject) Add(fields ...Field) {
+	for _, field := range fields {
+		if !o.inline {
+			o.buf = o.enc.appendField(o.buf, o.prefix, field)
+			continue
+		}
+		if o.n > 0 {
+			o.buf.WriteByte(' ')
+		}
+		o.buf = o.enc.text(o.buf, field.Name)
+		o.buf.WriteByte('=')
+		o.buf = o.enc.appendValue(o.buf, field)
+		o.n++
+	}
+}
+
+// Append добавляет элементы массива.
+func (o *consoleObject) Append(values ...Field) {
+	for _, value := range values {
+		if o.n > 0 {
+			o.buf.WriteByte(' ')
+		}
+		o.buf = o.enc.appendValue(o.buf, value)
+		o.n++
+	}
+}
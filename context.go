@@ -0,0 +1,20 @@
+package log
+
+import "context"
+
+// contextKey используется в качестве ключа для сохранения лога в контексте.
+type contextKey struct{}
+
+// NewContext возвращает копию контекста с сохраненным в нем логом.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext возвращает лог, сохраненный в контексте. Если лог в контексте
+// не задан, то возвращается лог по умолчанию.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return &h.Logger
+}
@@ -0,0 +1,206 @@
+package log
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Encrypter описывает поток вывода лога, шифрующий каждую запись отдельно с
+// помощью AES-GCM. Каждый вызов Write записывает в поток одну запись вида:
+//
+//	длина (4 байта, big endian) | длина ID ключа (1 байт) | ID ключа |
+//	nonce (12 байт) | зашифрованные данные с меткой аутентификации
+//
+// Длина включает все следующие за ней части записи. Идентификатор ключа
+// аутентифицируется вместе с данными и позволяет менять ключи с помощью
+// SetKey без перезапуска приложения. Так как nonce выбирается случайно, ключ
+// рекомендуется менять не реже, чем через 2^32 записей.
+//
+// Writer передает в поток каждую запись лога одним вызовом Write, поэтому
+// записи лога и зашифрованные записи соответствуют друг другу.
+type Encrypter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	id    string
+	aead  cipher.AEAD
+	frame []byte
+}
+
+// maxRecordSize задает максимальный размер зашифрованной записи.
+const maxRecordSize = 64 << 20
+
+// NewEncrypter возвращает поток, шифрующий записи ключом key длиной 16, 24
+// или 32 байта с идентификатором id.
+func NewEncrypter(w io.Writer, id string, key []byte) (*Encrypter, error) {
+	var e = &Encrypter{w: w}
+	if err := e.SetKey(id, key); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetKey заменяет ключ шифрования следующих записей. Идентификатор ключа
+// должен быть не длиннее 255 байт.
+func (e *Encrypter) SetKey(id string, key []byte) error {
+	if len(id) > 255 {
+		return errors.New("log: key id too long")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.id, e.aead = id, aead
+	e.mu.Unlock()
+	return nil
+}
+
+// Write шифрует данные и записывает их в поток одной записью.
+func (e *Encrypter) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var size = 1 + len(e.id) + e.aead.NonceSize() + len(p) + e.aead.Overhead()
+	if size > maxRecordSize {
+		return 0, errors.New("log: record too large")
+	}
+	var frame = append(e.frame[:0], 0, 0, 0, 0, byte(len(e.id)))
+	binary.BigEndian.PutUint32(frame, uint32(size))
+	frame = append(frame, e.id...)
+	var pos = len(frame)
+	frame = append(frame, make([]byte, e.aead.NonceSize())...)
+	var nonce = frame[pos:]
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	frame = e.aead.Seal(frame, nonce, p, frame[5:pos])
+	e.frame = frame
+	if _, err := e.w.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Sync сбрасывает буферизованные данные потока, если он поддерживает метод
+// Flush или Sync.
+func (e *Encrypter) Sync() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch w := e.w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Sync() error }:
+		return w.Sync()
+	}
+	return nil
+}
+
+// newAEAD возвращает AES-GCM для указанного ключа.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ErrDecrypt возвращается, если запись не может быть расшифрована: она
+// повреждена, изменена или зашифрована другим ключом.
+var ErrDecrypt = errors.New("log: record authentication failed")
+
+// KeyError возвращается, если ключ с идентификатором записи не задан.
+type KeyError struct {
+	ID string // идентификатор ключа
+}
+
+// Error поддерживает интерфейс error.
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("log: unknown key id %q", e.ID)
+}
+
+// Decrypter читает записи, зашифрованные с помощью Encrypter, и
+// возвращает их в расшифрованном виде. Если запись не удалось расшифровать,
+// то возвращается ошибка, а чтение можно продолжить со следующей записи.
+type Decrypter struct {
+	r    *bufio.Reader
+	keys map[string]cipher.AEAD
+	buf  []byte // прочитанная запись
+	data []byte // не возвращенная часть расшифрованных данных
+}
+
+// NewDecrypter возвращает читателя зашифрованных записей. Ключи задаются
+// в виде словаря с идентификаторами ключей в качестве имен.
+func NewDecrypter(r io.Reader, keys map[string][]byte) (*Decrypter, error) {
+	var d = &Decrypter{r: bufio.NewReader(r), keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		d.keys[id] = aead
+	}
+	return d, nil
+}
+
+// Next читает и расшифровывает следующую запись. Возвращаемые данные
+// действительны до следующего вызова. В конце потока возвращается io.EOF,
+// а для оборванной записи io.ErrUnexpectedEOF.
+func (d *Decrypter) Next() ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(d.r, header[:4]); err != nil {
+		return nil, err
+	}
+	var size = binary.BigEndian.Uint32(header[:4])
+	if size == 0 || size > maxRecordSize {
+		return nil, fmt.Errorf("log: bad record size %d", size)
+	}
+	if cap(d.buf) < int(size) {
+		d.buf = make([]byte, size)
+	}
+	var record = d.buf[:size]
+	if _, err := io.ReadFull(d.r, record); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	var n = int(record[0])
+	if 1+n > len(record) {
+		return nil, ErrDecrypt
+	}
+	var id = string(record[1 : 1+n])
+	aead, ok := d.keys[id]
+	if !ok {
+		return nil, &KeyError{ID: id}
+	}
+	var pos = 1 + n + aead.NonceSize()
+	if pos+aead.Overhead() > len(record) {
+		return nil, ErrDecrypt
+	}
+	data, err := aead.Open(record[pos:pos], record[1+n:pos], record[pos:], record[1:1+n])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return data, nil
+}
+
+// Read поддерживает интерфейс io.Reader и возвращает расшифрованные записи
+// одним потоком, который можно разбирать с помощью Decoder.
+func (d *Decrypter) Read(p []byte) (int, error) {
+	for len(d.data) == 0 {
+		data, err := d.Next()
+		if err != nil {
+			return 0, err
+		}
+		d.data = data
+	}
+	var n = copy(p, d.data)
+	d.data = d.data[n:]
+	return n, nil
+}
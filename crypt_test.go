@@ -0,0 +1,67 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestEncrypter(t *testing.T) {
+	var key1, key2 = bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	var out = new(bytes.Buffer)
+	enc, err := NewEncrypter(out, "k1", key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log = NewWriter(enc, INFO, new(Logfmt))
+	log.Info("first", "card", "4111")
+	if bytes.Contains(out.Bytes(), []byte("4111")) {
+		t.Fatal("data not encrypted")
+	}
+	if err := enc.SetKey("k2", key2); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("second")
+	var data = out.Bytes()
+
+	dec, err := NewDecrypter(bytes.NewReader(data),
+		map[string][]byte{"k1": key1, "k2": key2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry Entry
+	for i, line := range bytes.SplitAfter(plain, []byte("\n"))[:2] {
+		if err := new(Logfmt).Decode(line, &entry); err != nil ||
+			entry.Message != []string{"first", "second"}[i] {
+			t.Errorf("bad record %d: %q %v", i, line, err)
+		}
+	}
+
+	// поврежденная запись пропускается
+	var damaged = append([]byte(nil), data...)
+	damaged[20] ^= 1
+	dec, _ = NewDecrypter(bytes.NewReader(damaged),
+		map[string][]byte{"k1": key1, "k2": key2})
+	if _, err := dec.Next(); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("damaged record: %v", err)
+	}
+	if record, err := dec.Next(); err != nil || !bytes.Contains(record, []byte("second")) {
+		t.Errorf("bad record after damaged: %q %v", record, err)
+	}
+	dec, _ = NewDecrypter(bytes.NewReader(data[:len(data)-1]), map[string][]byte{"k2": key2})
+	var keyErr *KeyError
+	if _, err := dec.Next(); !errors.As(err, &keyErr) || keyErr.ID != "k1" {
+		t.Errorf("unknown key: %v", err)
+	}
+	if _, err := dec.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated record: %v", err)
+	}
+	if _, err := NewEncrypter(out, "bad", []byte("short")); err == nil {
+		t.Error("bad key accepted")
+	}
+}
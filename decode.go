@@ -0,0 +1,490 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decoder описывает интерфейс для разбора строк лога, сформированных с
+// помощью Encoder, обратно в записи. Форматы JSON, Console и Logfmt
+// поддерживают оба интерфейса, поэтому для разбора используются те же
+// настройки, что и для вывода.
+type Decoder interface {
+	// Decode разбирает строку лога и заполняет запись. Список полей записи
+	// используется повторно.
+	Decode(line []byte, entry *Entry) error
+}
+
+// ErrNotEntry возвращается, если строка не является записью лога в
+// ожидаемом формате.
+var ErrNotEntry = errors.New("log: not a log entry")
+
+// AutoDecoder определяет формат по содержимому строки: JSON начинается с
+// фигурной скобки, Logfmt с поля ts, а остальные строки разбираются как
+// Console с указанными настройками.
+type AutoDecoder struct {
+	Console Console // настройки разбора строк в формате Console
+}
+
+// Decode разбирает строку лога в формате, определенном по ее содержимому.
+func (d AutoDecoder) Decode(line []byte, entry *Entry) error {
+	switch {
+	case bytes.HasPrefix(line, []byte("{")):
+		return JSON{}.Decode(line, entry)
+	case bytes.HasPrefix(line, []byte("ts=")):
+		return Logfmt{}.Decode(line, entry)
+	default:
+		return d.Console.Decode(line, entry)
+	}
+}
+
+// reset очищает запись перед разбором.
+func (e *Entry) reset() {
+	e.Timestamp = time.Time{}
+	e.Level = INFO
+	e.Category = ""
+	e.Message = ""
+	for i := range e.Fields {
+		e.Fields[i] = Field{}
+	}
+	e.Fields = e.Fields[:0]
+}
+
+// Decode разбирает строку лога в формате JSON. Числа восстанавливаются как
+// Int64, Uint64 или Float64, строки с интервалами времени как Duration,
+// вложенные объекты как группы полей, а массивы как вложенные массивы.
+// Время записи сохраняется в JSON с точностью до секунды.
+//
+// JSON выводит интервалы времени строками, поэтому строковое поле со
+// значением вида "0s" или "1m30s" восстанавливается как Duration.
+func (f JSON) Decode(line []byte, entry *Entry) error {
+	entry.reset()
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return ErrNotEntry
+	}
+	var dec = json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if _, err := dec.Token(); err != nil { // {
+		return fmt.Errorf("%w: %v", ErrNotEntry, err)
+	}
+	for dec.More() {
+		field, err := decodeJSONField(dec)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotEntry, err)
+		}
+		switch field.Name {
+		case "ts":
+			if field.kind == int64Kind {
+				entry.Timestamp = time.Unix(int64(field.num), 0)
+				continue
+			}
+		case "lvl":
+			if field.kind == int64Kind && int64(field.num) >= -128 &&
+				int64(field.num) <= 127 {
+				entry.Level = Level(int64(field.num))
+				continue
+			}
+		case "log":
+			if field.kind == stringKind {
+				entry.Category = field.str
+				continue
+			}
+		case "msg":
+			if field.kind == stringKind {
+				entry.Message = field.str
+				continue
+			}
+		}
+		entry.Fields = append(entry.Fields, field)
+	}
+	if _, err := dec.Token(); err != nil { // }
+		return fmt.Errorf("%w: %v", ErrNotEntry, err)
+	}
+	return nil
+}
+
+// decodeJSONField читает из JSON имя и значение поля.
+func decodeJSONField(dec *json.Decoder) (Field, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return Field{}, err
+	}
+	var name, _ = token.(string)
+	return decodeJSONValue(dec, name)
+}
+
+// decodeJSONValue читает из JSON значение и возвращает поле с указанным
+// именем. Строки, совпадающие с выводом time.Duration.String, возвращаются
+// как Duration, так как JSON выводит интервалы времени в кавычках.
+func decodeJSONValue(dec *json.Decoder, name string) (Field, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return Field{}, err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		var fields []Field
+		for dec.More() {
+			var field Field
+			if value == '{' {
+				field, err = decodeJSONField(dec)
+			} else {
+				field, err = decodeJSONValue(dec, "")
+			}
+			if err != nil {
+				return Field{}, err
+			}
+			fields = append(fields, field)
+		}
+		if _, err := dec.Token(); err != nil {
+			return Field{}, err
+		}
+		if value == '{' {
+			return Group(name, fields...), nil
+		}
+		return Array(name, fieldArray(fields)), nil
+	case string:
+		if field, ok := parseDuration(name, value); ok {
+			return field, nil
+		}
+		return String(name, value), nil
+	case bool:
+		return Bool(name, value), nil
+	case json.Number:
+		if field, ok := parseNumber(name, string(value)); ok {
+			return field, nil
+		}
+		return String(name, string(value)), nil
+	default:
+		return Any(name, nil), nil
+	}
+}
+
+// parseNumber возвращает поле с числом, если строка является числом в том
+// виде, в котором его выводят форматы лога.
+func parseNumber(name, s string) (Field, bool) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil &&
+		strconv.FormatInt(n, 10) == s {
+		return Int64(name, n), true
+	}
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil &&
+		strconv.FormatUint(n, 10) == s {
+		return Uint64(name, n), true
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil &&
+		strconv.FormatFloat(n, 'g', -1, 64) == s {
+		return Float64(name, n), true
+	}
+	return Field{}, false
+}
+
+// parseDuration возвращает поле с интервалом времени, если строка является
+// интервалом в том виде, в котором его выводят форматы лога.
+func parseDuration(name, s string) (Field, bool) {
+	if d, err := time.ParseDuration(s); err == nil && d.String() == s {
+		return Duration(name, d), true
+	}
+	return Field{}, false
+}
+
+// fieldArray описывает массив значений, восстановленный при разборе лога.
+type fieldArray []Field
+
+// MarshalLogArray поддерживает интерфейс ArrayMarshaler.
+func (a fieldArray) MarshalLogArray(enc ArrayEncoder) {
+	enc.Append(a...)
+}
+
+// rawText описывает значение, которое не удалось отнести к определенному
+// типу при разборе. Оно выводится в исходном виде, без кавычек.
+type rawText string
+
+// String поддерживает интерфейс fmt.Stringer.
+func (t rawText) String() string { return string(t) }
+
+// Decode разбирает строку лога в формате Console. Строки выводятся в
+// кавычках и восстанавливаются как String, а числа, интервалы времени и
+// логические значения без кавычек восстанавливаются с соответствующим
+// типом. Поля вложенных объектов сохраняются с составными именами
+// "name.key", а управляющие символы в сообщении остаются в экранированном
+// виде. Граница между сообщением и полями определяется по первому пробелу,
+// после которого до конца строки следуют только пары "key=value".
+func (f Console) Decode(line []byte, entry *Entry) error {
+	entry.reset()
+	var s = strings.TrimSuffix(string(line), "\n")
+	if f.TimeFormat != "" {
+		// время занимает столько же слов, сколько их в формате
+		var pos = -1
+		for n := strings.Count(f.TimeFormat, " "); n >= 0; n-- {
+			var next = strings.IndexByte(s[pos+1:], ' ')
+			if next < 0 {
+				pos = len(s)
+				break
+			}
+			pos += next + 1
+		}
+		var loc = time.Local
+		if f.UTC {
+			loc = time.UTC
+		}
+		ts, err := time.ParseInLocation(f.TimeFormat, s[:pos], loc)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotEntry, err)
+		}
+		entry.Timestamp = ts
+		if s = s[pos:]; s != "" {
+			s = s[1:] // пропускаем пробел после времени
+		}
+	}
+	// уровень записи
+	var name, rest, _ = strings.Cut(s, " ")
+	lvl, ok := f.parseLevel(name)
+	if !ok {
+		return ErrNotEntry
+	}
+	entry.Level, s = lvl, rest
+	// категория
+	if strings.HasPrefix(s, "[") {
+		if pos := strings.Index(s, "]: "); pos > 0 {
+			entry.Category, s = s[1:pos], s[pos+3:]
+		}
+	}
+	entry.Message, entry.Fields = splitFields(s, entry.Fields, consoleValue)
+	return nil
+}
+
+// parseLevel возвращает уровень по строке, выведенной в лог, с учетом
+// переопределенных названий.
+func (f Console) parseLevel(name string) (Level, bool) {
+	for lvl, s := range f.Levels {
+		if s == name && s != "" {
+			return lvl, true
+		}
+	}
+	return parseLevel(strings.ToLower(name))
+}
+
+// consoleValue возвращает поле со значением, выведенным в формате Console.
+func consoleValue(name, raw string) (Field, bool) {
+	switch {
+	case raw == "":
+		return Field{}, false
+	case raw[0] == '"':
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return Field{}, false
+		}
+		return String(name, s), true
+	case raw[0] == '[' && raw[len(raw)-1] == ']':
+		if values, ok := splitValues(raw[1:len(raw)-1], consoleValue); ok {
+			return Array(name, fieldArray(values)), true
+		}
+	case raw[0] == '{' && raw[len(raw)-1] == '}':
+		if fields, ok := parseFields(raw[1:len(raw)-1], nil, consoleValue); ok {
+			return Group(name, fields...), true
+		}
+	case raw == "nil":
+		return Any(name, nil), true
+	case raw == "true" || raw == "false":
+		return Bool(name, raw == "true"), true
+	}
+	if field, ok := parseNumber(name, raw); ok {
+		return field, true
+	}
+	if field, ok := parseDuration(name, raw); ok {
+		return field, true
+	}
+	return Object(name, rawText(raw)), true
+}
+
+// Decode разбирает строку лога в формате Logfmt. Значения без кавычек
+// восстанавливаются как числа, логические значения, время или интервалы,
+// если их текстовое представление совпадает с выводимым в лог, а пустые
+// значения как nil. Поля вложенных объектов и элементы массивов сохраняются
+// с составными именами "name.key".
+func (f Logfmt) Decode(line []byte, entry *Entry) error {
+	entry.reset()
+	var s = strings.TrimSuffix(string(line), "\n")
+	fields, ok := parseFields(s, entry.Fields, logfmtValue)
+	if !ok || len(fields) < 2 || fields[0].Name != "ts" || fields[1].Name != "lvl" {
+		entry.Fields = fields[:0]
+		return ErrNotEntry
+	}
+	var layout = f.TimeFormat
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	var loc = time.Local
+	if f.UTC {
+		loc = time.UTC
+	}
+	ts, err := time.ParseInLocation(layout, fields[0].text(), loc)
+	if err != nil {
+		entry.Fields = fields[:0]
+		return fmt.Errorf("%w: %v", ErrNotEntry, err)
+	}
+	lvl, ok := parseLevel(strings.ToLower(fields[1].text()))
+	if !ok {
+		entry.Fields = fields[:0]
+		return ErrNotEntry
+	}
+	entry.Timestamp, entry.Level = ts, lvl
+	var n = 2
+	if n < len(fields) && fields[n].Name == "log" {
+		entry.Category = fields[n].text()
+		n++
+	}
+	if n < len(fields) && fields[n].Name == "msg" {
+		entry.Message = fields[n].text()
+		n++
+	}
+	entry.Fields = append(fields[:0], fields[n:]...)
+	return nil
+}
+
+// text возвращает текстовое представление значения поля, восстановленного
+// при разборе.
+func (f Field) text() string {
+	switch f.kind {
+	case stringKind:
+		return f.str
+	case timeKind:
+		return f.time().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(f.Interface())
+	}
+}
+
+// logfmtValue возвращает поле со значением, выведенным в формате Logfmt.
+func logfmtValue(name, raw string) (Field, bool) {
+	switch {
+	case raw == "":
+		return Any(name, nil), true
+	case raw[0] == '"':
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return Field{}, false
+		}
+		return String(name, s), true
+	case raw == "true" || raw == "false":
+		return Bool(name, raw == "true"), true
+	}
+	if field, ok := parseNumber(name, raw); ok {
+		return field, true
+	}
+	if field, ok := parseDuration(name, raw); ok {
+		return field, true
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, raw); err == nil &&
+		ts.Format(time.RFC3339Nano) == raw {
+		return Time(name, ts), true
+	}
+	return String(name, raw), true
+}
+
+// splitFields отделяет текст сообщения от следующих за ним полей.
+func splitFields(s string, fields []Field,
+	value func(name, raw string) (Field, bool)) (string, []Field) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' {
+			continue
+		}
+		if result, ok := parseFields(s[i+1:], fields, value); ok {
+			return s[:i], result
+		}
+	}
+	return s, fields
+}
+
+// parseFields разбирает строку с парами "key=value", разделенными пробелом,
+// и добавляет поля к списку.
+func parseFields(s string, fields []Field,
+	value func(name, raw string) (Field, bool)) ([]Field, bool) {
+	var n = len(fields)
+	for len(s) > 0 {
+		var pos = strings.IndexAny(s, "= ")
+		if pos <= 0 || s[pos] != '=' {
+			return fields[:n], false
+		}
+		var name = s[:pos]
+		raw, rest, ok := scanValue(s[pos+1:])
+		if !ok {
+			return fields[:n], false
+		}
+		field, ok := value(name, raw)
+		if !ok {
+			return fields[:n], false
+		}
+		fields = append(fields, field)
+		s = rest
+	}
+	return fields, true
+}
+
+// splitValues разбирает строку со значениями, разделенными пробелом.
+func splitValues(s string,
+	value func(name, raw string) (Field, bool)) ([]Field, bool) {
+	var values []Field
+	for len(s) > 0 {
+		raw, rest, ok := scanValue(s)
+		if !ok {
+			return nil, false
+		}
+		field, ok := value("", raw)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, field)
+		s = rest
+	}
+	return values, true
+}
+
+// scanValue выделяет из начала строки значение: строку в кавычках, значение
+// в скобках или текст до пробела. За значением должен следовать пробел или
+// конец строки.
+func scanValue(s string) (raw, rest string, ok bool) {
+	var depth int
+	var quoted bool
+	var i int
+scan:
+	for ; i < len(s); i++ {
+		var c = s[i]
+		switch {
+		case quoted && c == '\\':
+			i++ // пропускаем экранированный символ
+		case c == '"':
+			quoted = !quoted
+			if !quoted && depth == 0 {
+				i++
+				break scan
+			}
+		case quoted:
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			if depth > 0 {
+				depth--
+			}
+		case c == ' ' && depth == 0:
+			break scan
+		}
+	}
+	if quoted || depth > 0 || i > len(s) {
+		return "", "", false
+	}
+	raw, rest = s[:i], s[i:]
+	if rest != "" {
+		if rest[0] != ' ' {
+			return "", "", false
+		}
+		rest = rest[1:]
+	}
+	return raw, rest, true
+}
@@ -0,0 +1,88 @@
+package log
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	var ts = time.Date(2024, 5, 1, 12, 30, 15, 0, time.UTC)
+	var entry = &Entry{
+		Timestamp: ts,
+		Level:     WARN,
+		Category:  "db.query",
+		Message:   "slow query\nnext line",
+		Fields: []Field{String("sql", "SELECT 1"), Int64("rows", -5),
+			Uint64("size", 1<<63), Float64("ratio", 0.25), Bool("cached", false),
+			Any("nil", nil), Err(errors.New("timeout")),
+			Object("user", testUser{"Bob", []string{"admin", "dev"}}),
+			Group("http", Int64("status", 503), String("path", "/api"))},
+	}
+	for _, test := range []struct {
+		name string
+		enc  interface {
+			Encoder
+			Decoder
+		}
+	}{
+		{"JSON", JSON{}},
+		{"Console", Console{TimeFormat: "2006-01-02 15:04:05", UTC: true}},
+		{"Logfmt", Logfmt{UTC: true}},
+	} {
+		var line = test.enc.Encode(nil, entry)
+		var decoded = new(Entry)
+		if err := test.enc.Decode(line, decoded); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !decoded.Timestamp.Equal(ts) || decoded.Level != WARN ||
+			decoded.Category != "db.query" {
+			t.Errorf("%s: bad entry %v %v %q", test.name, decoded.Timestamp,
+				decoded.Level, decoded.Category)
+		}
+		if got := string(test.enc.Encode(nil, decoded)); got != string(line) {
+			t.Errorf("%s: round trip:\n%s%s", test.name, line, got)
+		}
+		if field, ok := decoded.Lookup("rows"); !ok || field.Interface() != int64(-5) {
+			t.Errorf("%s: bad field: %#v", test.name, field.Interface())
+		}
+	}
+	var decoded = new(Entry)
+	if err := (JSON{}).Decode(JSON{}.Encode(nil, entry), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if field, ok := decoded.Lookup("http.status"); !ok || field.Interface() != int64(503) {
+		t.Errorf("bad group field: %v", field.Interface())
+	}
+	// управляющие символы и ошибки кодировки
+	var ctrl = &Entry{Timestamp: ts, Level: INFO, Message: "a\x1bb\u0085\xff",
+		Fields: []Field{String("s", "q\"\\\x00\u2028")}}
+	var line = JSON{}.Encode(nil, ctrl)
+	if got, want := string(line), `{"ts":1714566615,"lvl":0,"msg":"a\u001bb`+
+		"\u0085\ufffd"+`","s":"q\"\\\u0000`+"\u2028"+`"}`+"\n"; got != want {
+		t.Errorf("bad JSON escaping: %s", got)
+	}
+	if err := (JSON{}).Decode(line, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if field, _ := decoded.Lookup("s"); decoded.Message != "a\x1bb\u0085\ufffd" ||
+		field.Interface() != "q\"\\\x00\u2028" {
+		t.Errorf("bad decoded entry: %q %q", decoded.Message, field.Interface())
+	}
+	// интервалы времени выводятся в JSON строками
+	if err := (JSON{}).Decode([]byte(`{"ts":0,"lvl":0,"d":"0s","s":"1 s"}`), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := decoded.Lookup("d"); d.Interface() != time.Duration(0) {
+		t.Errorf("bad duration field: %#v", d.Interface())
+	}
+	if s, _ := decoded.Lookup("s"); s.Interface() != "1 s" {
+		t.Errorf("bad string field: %#v", s.Interface())
+	}
+	for _, dec := range []Decoder{JSON{}, Console{TimeFormat: time.RFC3339}, Logfmt{}} {
+		if err := dec.Decode([]byte("plain text"), decoded); !errors.Is(err, ErrNotEntry) {
+			t.Errorf("%T: unexpected error %v", dec, err)
+		}
+	}
+}
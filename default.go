@@ -15,9 +15,9 @@ func init() {
 }
 
 // default используется как лог по умолчанию.
-var h = &Writer{w: os.Stderr, lvl: INFO, enc: &Console{
+var h = NewWriter(os.Stderr, INFO, &Console{
 	TimeFormat: "2006-01-02 15:04:05",
-}}
+})
 
 // Flag возвращает лог по умолчанию в качестве значения для установки через
 // параметры приложения.
@@ -33,10 +33,13 @@ func SetLevel(lvl Level) {
 
 // GetLevel возвращает текущий уровень лога по умолчанию.
 func GetLevel() Level {
-	h.mu.RLock()
-	level := h.lvl
-	h.mu.RUnlock()
-	return level
+	return h.GetLevel()
+}
+
+// Enabled возвращает true, если запись с указанным уровнем будет выведена в
+// лог по умолчанию.
+func Enabled(lvl Level) bool {
+	return h.Enabled(lvl, "")
 }
 
 // SetOutput переопределяет вывод лога по умолчанию. Изначально используется
@@ -52,6 +55,18 @@ func SetFormat(enc Encoder) {
 	h.SetFormat(enc)
 }
 
+// SetErrorHandler задает функцию, вызываемую при ошибках записи в лог по
+// умолчанию.
+func SetErrorHandler(fn ErrorHandler) {
+	h.SetErrorHandler(fn)
+}
+
+// SetFallback задает резервный поток вывода лога по умолчанию, который
+// используется после failures ошибок записи подряд.
+func SetFallback(w io.Writer, failures int) {
+	h.SetFallback(w, failures)
+}
+
 // IsTTY возвращает true, если лог выводится в терминал или в файл.
 func IsTTY() bool {
 	return h.IsTTY()
@@ -64,37 +79,107 @@ func New(name string, fields ...interface{}) *Logger {
 
 // Log выводит сообщение с указанным уровнем в лог по умолчанию.
 func Log(lvl Level, msg string, fields ...interface{}) {
-	h.Write(lvl, "", msg, h.with(fields))
+	h.write(lvl, msg, fields)
 }
 
 // Trace выводит необязательное отладочное сообщение в лог по умолчанию.
 func Trace(msg string, fields ...interface{}) {
-	h.Write(TRACE, "", msg, h.with(fields))
+	h.write(TRACE, msg, fields)
 }
 
 // Debug выводит отладочное сообщение в лог по умолчанию.
 func Debug(msg string, fields ...interface{}) {
-	h.Write(DEBUG, "", msg, h.with(fields))
+	h.write(DEBUG, msg, fields)
 }
 
 // Info выводит информационное сообщение в лог по умолчанию.
 func Info(msg string, fields ...interface{}) {
-	h.Write(INFO, "", msg, h.with(fields))
+	h.write(INFO, msg, fields)
 }
 
 // Warn выводит сообщение с предупреждением в лог по умолчанию.
 func Warn(msg string, fields ...interface{}) {
-	h.Write(WARN, "", msg, h.with(fields))
+	h.write(WARN, msg, fields)
 }
 
 // Error выводит сообщение об ошибке в лог по умолчанию.
 func Error(msg string, fields ...interface{}) {
-	h.Write(ERROR, "", msg, h.with(fields))
+	h.write(ERROR, msg, fields)
+}
+
+// Panic выводит сообщение в лог по умолчанию и вызывает panic.
+func Panic(msg string, fields ...interface{}) {
+	h.write(PANIC, msg, fields)
+	panic(msg)
 }
 
-// Fatal выводит сообщение о критической ошибке в лог по умолчанию.
+// Fatal выводит сообщение о критической ошибке в лог по умолчанию и завершает
+// приложение.
 func Fatal(msg string, fields ...interface{}) {
-	h.Write(FATAL, "", msg, h.with(fields))
+	h.write(FATAL, msg, fields)
+	exit(h)
+}
+
+// Logf выводит форматированное сообщение с указанным уровнем в лог по
+// умолчанию. Форматирование выполняется только в том случае, если сообщение
+// будет выведено в лог.
+func Logf(lvl Level, format string, args ...interface{}) {
+	h.logf(lvl, format, args)
+}
+
+// Tracef выводит необязательное форматированное отладочное сообщение в лог
+// по умолчанию.
+func Tracef(format string, args ...interface{}) {
+	h.logf(TRACE, format, args)
+}
+
+// Debugf выводит форматированное отладочное сообщение в лог по умолчанию.
+func Debugf(format string, args ...interface{}) {
+	h.logf(DEBUG, format, args)
+}
+
+// Infof выводит форматированное информационное сообщение в лог по умолчанию.
+func Infof(format string, args ...interface{}) {
+	h.logf(INFO, format, args)
+}
+
+// Warnf выводит форматированное сообщение с предупреждением в лог по
+// умолчанию.
+func Warnf(format string, args ...interface{}) {
+	h.logf(WARN, format, args)
+}
+
+// Errorf выводит форматированное сообщение об ошибке в лог по умолчанию.
+func Errorf(format string, args ...interface{}) {
+	h.logf(ERROR, format, args)
+}
+
+// Panicf выводит форматированное сообщение в лог по умолчанию и вызывает
+// panic.
+func Panicf(format string, args ...interface{}) {
+	h.Panicf(format, args...)
+}
+
+// Fatalf выводит форматированное сообщение о критической ошибке в лог по
+// умолчанию и завершает приложение.
+func Fatalf(format string, args ...interface{}) {
+	h.logf(FATAL, format, args)
+	exit(h)
+}
+
+// Recover перехватывает panic и записывает её в лог по умолчанию с уровнем
+// ERROR вместе со стеком вызовов. Должен вызываться непосредственно с помощью
+// defer.
+func Recover() {
+	if r := recover(); r != nil {
+		h.recovered(r, ERROR)
+	}
+}
+
+// Go выполняет функцию в отдельной горутине, перехватывая возникшую в ней
+// panic и записывая её в лог по умолчанию.
+func Go(fn func()) {
+	h.Go(fn)
 }
 
 // With возвращает новую запись в лог с дополнительными параметрами.
@@ -107,3 +192,15 @@ func StdLog(lvl Level, name string, fields ...interface{}) *log.Logger {
 	return log.New(&std{l: &Logger{h: h, name: name, fields: h.with(fields)},
 		lvl: lvl}, "", 0)
 }
+
+// StartTimer запускает таймер, записывающий время выполнения в лог по
+// умолчанию.
+func StartTimer(msg string, fields ...interface{}) *Timer {
+	return h.Timer(msg, fields...)
+}
+
+// Enter записывает в лог по умолчанию сообщения о входе в функцию и выходе
+// из нее.
+func Enter(name string, fields ...interface{}) func() {
+	return h.Enter(name, fields...)
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,33 +15,155 @@ type Entry struct {
 	Fields    []Field   // дополнительные поля
 }
 
-// NewEntry создает новое описание записи в лог.
+// NewEntry создает новое описание записи в лог. Поля с повторяющимися
+// именами заменяют значения ранее заданных полей. Переданный список полей
+// копируется, поэтому может быть повторно использован после вызова.
 func NewEntry(lvl Level, category, msg string, fields []Field) *Entry {
-	var names = make(map[string]int, len(fields))
-	var result = make([]Field, 0, len(fields))
-	for i, field := range fields {
+	var entry = entries.Get().(*Entry)
+	entry.Timestamp = time.Time{} // не устанавливаем время до записи
+	entry.Level = lvl
+	entry.Category = category
+	entry.Message = msg
+	entry.Fields = appendUnique(entry.Fields[:0], fields)
+	return entry
+}
+
+// maxScanFields задает количество полей, до которого поиск повторяющихся
+// имен выполняется простым перебором без выделения памяти.
+const maxScanFields = 16
+
+// appendUnique добавляет поля к списку, заменяя значения полей с уже
+// существующими именами.
+func appendUnique(result, fields []Field) []Field {
+	var names map[string]int // используется только для больших списков
+	if len(fields) > maxScanFields {
+		names = make(map[string]int, len(fields))
+	}
+next:
+	for _, field := range fields {
 		if field.Name == "" {
 			field.Name = "_" // подменяем пустое имя
 		}
+		switch field.kind {
+		case anyKind:
+			field.Value = resolve(field.Value)
+		case groupKind: // повторяющиеся имена проверяются внутри группы
+			group, _ := field.group()
+			if group = appendUnique(nil, group); len(group) == 0 {
+				continue // пустые группы не выводятся
+			}
+			field.Value = group
+		}
 		// проверяем, что поле с таким именем уже было
-		if pos, ok := names[field.Name]; ok {
-			result[pos].Value = field.Value // заменяем старое значение на новое
-			continue
+		if names != nil {
+			if pos, ok := names[field.Name]; ok {
+				result[pos] = field // заменяем старое значение на новое
+				continue
+			}
+			names[field.Name] = len(result) // сохраняем позицию
+		} else {
+			for pos := range result {
+				if result[pos].Name == field.Name {
+					result[pos] = field
+					continue next
+				}
+			}
 		}
 		result = append(result, field)
-		names[field.Name] = i // сохраняем позицию
 	}
-	var entry = entries.Get().(*Entry)
-	entry.Timestamp = time.Time{} // не устанавливаем время до записи
-	entry.Level = lvl
-	entry.Category = category
-	entry.Message = msg
-	entry.Fields = result
-	return entry
+	return result
 }
 
-// Free помещает объект для формирования записи лога обратно в пул.
+// resolve вычисляет отложенные значения полей. Количество вложенных
+// вычислений ограничено, чтобы избежать зацикливания.
+func resolve(value interface{}) interface{} {
+	for i := 0; i < 8; i++ {
+		switch v := value.(type) {
+		case LogValuer:
+			value = v.LogValue()
+		case func() interface{}:
+			value = v()
+		default:
+			return value
+		}
+	}
+	return value
+}
+
+// Get возвращает значение дополнительного поля с указанным именем.
+func (e *Entry) Get(name string) (interface{}, bool) {
+	for _, field := range e.Fields {
+		if field.Name == name {
+			return field.Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// Lookup возвращает дополнительное поле с указанным именем. Поля вложенных
+// групп задаются через точку: "http.status".
+func (e *Entry) Lookup(name string) (Field, bool) {
+	return lookupField(e.Fields, name)
+}
+
+// lookupField возвращает поле из списка. Если поля с таким именем нет, то имя
+// разбирается как путь к полю группы.
+func lookupField(fields []Field, name string) (Field, bool) {
+	for _, field := range fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	var pos = strings.IndexByte(name, '.')
+	if pos < 0 {
+		return Field{}, false
+	}
+	if field, ok := lookupField(fields, name[:pos]); ok {
+		if group, ok := field.group(); ok {
+			return lookupField(group, name[pos+1:])
+		}
+	}
+	return Field{}, false
+}
+
+// Set устанавливает значение дополнительного поля с указанным именем. Если
+// такого поля нет, то оно добавляется в конец списка.
+func (e *Entry) Set(name string, value interface{}) {
+	for i, field := range e.Fields {
+		if field.Name == name {
+			e.Fields[i] = Field{Name: name, Value: value}
+			return
+		}
+	}
+	e.Fields = append(e.Fields, Field{Name: name, Value: value})
+}
+
+// Delete удаляет дополнительное поле с указанным именем.
+func (e *Entry) Delete(name string) {
+	for i, field := range e.Fields {
+		if field.Name == name {
+			e.Fields = append(e.Fields[:i], e.Fields[i+1:]...)
+			return
+		}
+	}
+}
+
+// maxPoolFields задает максимальный размер списка полей записи, который
+// сохраняется при возврате записи в пул.
+const maxPoolFields = 64
+
+// Free помещает объект для формирования записи лога обратно в пул. После
+// вызова запись и её поля не должны использоваться.
 func (e *Entry) Free() {
+	if cap(e.Fields) > maxPoolFields {
+		e.Fields = nil
+	} else {
+		// освобождаем ссылки на значения полей
+		for i := range e.Fields {
+			e.Fields[i] = Field{}
+		}
+		e.Fields = e.Fields[:0]
+	}
 	entries.Put(e)
 }
 
@@ -0,0 +1,117 @@
+package log
+
+import (
+	"unicode/utf8"
+)
+
+// appendSafe добавляет в буфер текст, экранируя управляющие символы, чтобы
+// данные из недоверенных источников не могли подделать записи лога или
+// изменить состояние терминала с помощью управляющих последовательностей.
+// Символы экранируются так же, как в строках Go ("\n", "\x1b", "\u202e").
+// Если задан indent, то перевод строки не экранируется, а следующая строка
+// выводится с этим отступом.
+func appendSafe(buf buffer, s, indent string) buffer {
+	var start = 0 // начало еще не добавленной части строки
+	for i := 0; i < len(s); {
+		var c = s[i]
+		if c >= 0x20 && c < 0x7f { // основной случай: печатный символ ASCII
+			i++
+			continue
+		}
+		var r, size = rune(c), 1
+		if c >= utf8.RuneSelf {
+			r, size = utf8.DecodeRuneInString(s[i:])
+			if r != utf8.RuneError && !unsafeRune(r) {
+				i += size
+				continue
+			}
+		}
+		buf.WriteString(s[start:i])
+		switch {
+		case r == '\n' && indent != "":
+			buf.WriteByte('\n')
+			buf.WriteString(indent)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < utf8.RuneSelf || size == 1: // ASCII или ошибка кодировки
+			buf.WriteString(`\x`)
+			buf.WriteByte(hexDigits[c>>4])
+			buf.WriteByte(hexDigits[c&0xf])
+		default:
+			buf.WriteString(`\u`)
+			for shift := 12; shift >= 0; shift -= 4 {
+				buf.WriteByte(hexDigits[r>>uint(shift)&0xf])
+			}
+		}
+		i += size
+		start = i
+	}
+	buf.WriteString(s[start:])
+	return buf
+}
+
+// unsafeRune возвращает true для символов, которые не выводятся как текст и
+// могут изменить отображение строки: управляющих символов C1, разделителей
+// строк и символов управления направлением текста.
+func unsafeRune(r rune) bool {
+	switch {
+	case r >= 0x80 && r < 0xa0, // C1, включая CSI (0x9b)
+		r == 0x2028, r == 0x2029, // разделители строк и абзацев
+		r >= 0x202a && r <= 0x202e, // управление направлением текста
+		r >= 0x2066 && r <= 0x2069:
+		return true
+	}
+	return false
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString добавляет в буфер строку в кавычках по правилам JSON.
+// Управляющие символы записываются в виде "\u001b", а ошибки кодировки
+// UTF-8 заменяются на символ U+FFFD.
+func appendJSONString(buf buffer, s string) buffer {
+	buf.WriteByte('"')
+	var start = 0 // начало еще не добавленной части строки
+	for i := 0; i < len(s); {
+		var c = s[i]
+		if c >= utf8.RuneSelf {
+			var r, size = utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf.WriteString(s[start:i])
+				buf.WriteString("\ufffd")
+				start = i + size
+			}
+			i += size
+			continue
+		}
+		if c >= 0x20 && c != '"' && c != '\\' {
+			i++
+			continue
+		}
+		buf.WriteString(s[start:i])
+		switch c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hexDigits[c>>4])
+			buf.WriteByte(hexDigits[c&0xf])
+		}
+		i++
+		start = i
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+	return buf
+}
@@ -0,0 +1,92 @@
+package log
+
+import (
+	"os"
+	"sync"
+)
+
+// Flusher описывает интерфейс обработчика лога, поддерживающего сброс
+// буферизованных записей. Перед завершением приложения методами Fatal
+// сбрасываются обработчик вызвавшего их лога, лог по умолчанию и
+// обработчики, зарегистрированные с помощью FlushAtExit.
+type Flusher interface {
+	Flush() error
+}
+
+var (
+	exitMu    sync.Mutex
+	exitHooks []func()  // функции, вызываемые перед завершением
+	flushers  []Flusher // обработчики, сбрасываемые перед завершением
+	exitCode  = 1       // код завершения приложения для Fatal
+	exitFunc  = os.Exit // функция завершения приложения
+)
+
+// AtExit регистрирует функцию, которая будет вызвана перед завершением
+// приложения с помощью Fatal или Exit. Функции вызываются в порядке, обратном
+// порядку их регистрации. Используется, например, для сброса асинхронных
+// обработчиков лога и закрытия файлов.
+func AtExit(fn func()) {
+	exitMu.Lock()
+	exitHooks = append(exitHooks, fn)
+	exitMu.Unlock()
+}
+
+// FlushAtExit регистрирует обработчики лога, которые будут сброшены перед
+// завершением приложения с помощью Fatal или Exit, до вызова функций
+// AtExit. Используется для асинхронных и буферизующих обработчиков, записи
+// в которые могут не дойти до потока вывода, если приложение завершается
+// через другой лог.
+func FlushAtExit(handlers ...Flusher) {
+	exitMu.Lock()
+	flushers = append(flushers, handlers...)
+	exitMu.Unlock()
+}
+
+// SetExitCode задает код завершения приложения, используемый Fatal.
+// По умолчанию используется 1.
+func SetExitCode(code int) {
+	exitMu.Lock()
+	exitCode = code
+	exitMu.Unlock()
+}
+
+// SetExitFunc переопределяет функцию завершения приложения. По умолчанию
+// используется os.Exit. Переопределение удобно для тестирования. Если
+// передан nil, то восстанавливается os.Exit.
+func SetExitFunc(fn func(code int)) {
+	if fn == nil {
+		fn = os.Exit
+	}
+	exitMu.Lock()
+	exitFunc = fn
+	exitMu.Unlock()
+}
+
+// Exit сбрасывает лог по умолчанию и обработчики, зарегистрированные с
+// помощью FlushAtExit, вызывает зарегистрированные функции AtExit и
+// завершает приложение с указанным кодом.
+func Exit(code int) {
+	exitMu.Lock()
+	var hooks, list, exit = exitHooks, flushers, exitFunc
+	exitMu.Unlock()
+	h.Flush()
+	for _, f := range list {
+		f.Flush()
+	}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+	exit(code)
+}
+
+// exit сбрасывает обработчик лога и завершает приложение с помощью Exit с
+// кодом, заданным SetExitCode.
+func exit(h Handler) {
+	if f, ok := h.(Flusher); ok {
+		f.Flush()
+	}
+	exitMu.Lock()
+	var code = exitCode
+	exitMu.Unlock()
+	Exit(code)
+}
@@ -0,0 +1,198 @@
+package log
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrorHandler описывает функцию, которая вызывается при ошибке записи в
+// лог с уровнем, разделом и текстом сообщения записи. Функция не должна
+// записывать в тот же лог, иначе при неисправном потоке вывода это
+// приведет к бесконечной рекурсии.
+type ErrorHandler func(err error, lvl Level, category, msg string)
+
+// ErrorState описывает состояние ошибок записи в лог.
+type ErrorState struct {
+	Errors         uint64    // всего ошибок записи
+	Consecutive    int       // ошибок записи подряд
+	Fallback       bool      // записи выводятся в резервный поток
+	FallbackWrites uint64    // записей, выведенных в резервный поток
+	Skipped        uint64    // записей, не переданных в основной поток
+	LastError      error     // последняя ошибка записи
+	LastTime       time.Time // время последней ошибки
+}
+
+// fallbackRetry задает интервал между повторными попытками записи в
+// основной поток после перехода на резервный.
+var fallbackRetry = 5 * time.Second
+
+// failures подсчитывает ошибки записи и определяет, когда использовать
+// резервный поток. Используется Writer и Failsafe.
+type failures struct {
+	mu      sync.Mutex
+	state   ErrorState
+	retry   time.Time    // время следующей попытки записи в основной поток
+	onError atomic.Value // ErrorHandler
+}
+
+// setHandler задает функцию, вызываемую при ошибках записи.
+func (f *failures) setHandler(fn ErrorHandler) {
+	f.onError.Store(fn)
+}
+
+// write выполняет запись с помощью функции primary, а после limit ошибок
+// подряд с помощью fallback, если она задана. Пока используется резервный
+// поток, основной пропускается и периодически проверяется повторно. Без
+// резервного потока записи всегда передаются в основной.
+// Возвращает ошибку записи в основной поток, а для пропущенных записей
+// последнюю из таких ошибок, поэтому неисправность основного потока видна
+// и при использовании резервного. При ошибке записи в основной поток
+// вызывается ErrorHandler.
+func (f *failures) write(lvl Level, category, msg string, limit int,
+	primary, fallback func() error) error {
+	if fallback == nil {
+		limit = 0 // переключаться некуда
+	} else if err := f.skip(); err != nil {
+		fallback()
+		return err
+	}
+	var err = primary()
+	if err == nil {
+		f.success()
+		return nil
+	}
+	var useFallback = f.failure(err, limit)
+	if fn, _ := f.onError.Load().(ErrorHandler); fn != nil {
+		fn(err, lvl, category, msg)
+	}
+	if useFallback {
+		f.mu.Lock()
+		f.state.FallbackWrites++
+		f.mu.Unlock()
+		fallback()
+	}
+	return err
+}
+
+// skip возвращает последнюю ошибку, если запись нужно сразу вывести в
+// резервный поток, не обращаясь к основному.
+func (f *failures) skip() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.state.Fallback {
+		return nil
+	}
+	if now := time.Now(); now.After(f.retry) {
+		f.retry = now.Add(fallbackRetry)
+		return nil // пробуем основной поток
+	}
+	f.state.Skipped++
+	f.state.FallbackWrites++
+	return f.state.LastError
+}
+
+// success отмечает успешную запись в основной поток.
+func (f *failures) success() {
+	f.mu.Lock()
+	f.state.Consecutive = 0
+	f.state.Fallback = false
+	f.mu.Unlock()
+}
+
+// failure отмечает ошибку записи в основной поток и возвращает true, если
+// запись нужно вывести в резервный поток. Переход на резервный поток
+// выполняется после limit ошибок подряд; если limit не больше нуля, то не
+// выполняется.
+func (f *failures) failure(err error, limit int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state.Errors++
+	f.state.Consecutive++
+	f.state.LastError = err
+	f.state.LastTime = time.Now()
+	if limit > 0 && f.state.Consecutive >= limit && !f.state.Fallback {
+		f.state.Fallback = true
+		f.retry = f.state.LastTime.Add(fallbackRetry)
+	}
+	return f.state.Fallback
+}
+
+// get возвращает текущее состояние.
+func (f *failures) get() ErrorState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+// Failsafe описывает обработчик, отслеживающий ошибки записи другого
+// обработчика. При каждой ошибке вызывается ErrorHandler, а после
+// нескольких ошибок подряд записи передаются резервному обработчику. Пока
+// используется резервный обработчик, запись в основной периодически
+// повторяется, и при успехе работа с ним возобновляется.
+type Failsafe struct {
+	h        Handler
+	fallback Handler
+	limit    int
+	errs     failures
+	Logger
+}
+
+// NewFailsafe возвращает обработчик, передающий записи обработчику h, а
+// после limit ошибок записи подряд резервному обработчику fallback. Если
+// fallback равен nil, то используется вывод в os.Stderr в формате Console.
+// Если limit не больше нуля, то используется 3.
+func NewFailsafe(h, fallback Handler, limit int) *Failsafe {
+	if fallback == nil {
+		fallback = NewWriter(os.Stderr, TRACE, &Console{
+			TimeFormat: "2006-01-02 15:04:05",
+		})
+	}
+	if limit <= 0 {
+		limit = 3
+	}
+	var f = &Failsafe{h: h, fallback: fallback, limit: limit}
+	f.Logger = Logger{h: f}
+	return f
+}
+
+// SetErrorHandler задает функцию, вызываемую при ошибках записи основного
+// обработчика.
+func (f *Failsafe) SetErrorHandler(fn ErrorHandler) {
+	f.errs.setHandler(fn)
+}
+
+// ErrorState возвращает состояние ошибок записи.
+func (f *Failsafe) ErrorState() ErrorState {
+	return f.errs.get()
+}
+
+// Enabled поддерживает интерфейс Enabler.
+func (f *Failsafe) Enabled(lvl Level, category string) bool {
+	return enabled(f.h, lvl, category)
+}
+
+// Write поддерживает интерфейс Handler. Возвращает ошибку записи основного
+// обработчика, даже если запись передана резервному.
+func (f *Failsafe) Write(lvl Level, category, msg string, fields []Field) error {
+	if !enabled(f.h, lvl, category) {
+		return nil
+	}
+	return f.errs.write(lvl, category, msg, f.limit,
+		func() error { return f.h.Write(lvl, category, msg, fields) },
+		func() error { return f.fallback.Write(lvl, category, msg, fields) })
+}
+
+// Flush сбрасывает буферизованные записи обоих обработчиков.
+func (f *Failsafe) Flush() error {
+	var result error
+	for _, h := range []Handler{f.h, f.fallback} {
+		if flusher, ok := h.(Flusher); ok {
+			if err := flusher.Flush(); err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterFallback(t *testing.T) {
+	fallbackRetry = time.Hour
+	defer func() { fallbackRetry = 5 * time.Second }()
+	var fallback, out = new(strings.Builder), new(strings.Builder)
+	var log = NewWriter(failWriter{}, INFO, new(Console))
+	var failed []string
+	log.SetErrorHandler(func(err error, lvl Level, category, msg string) {
+		failed = append(failed, msg+": "+err.Error())
+	})
+	log.SetFallback(fallback, 2)
+	log.Info("one")
+	log.Info("two")
+	// основной поток пропускается, но ошибка по-прежнему возвращается
+	if err := log.Write(INFO, "", "three", nil); err == nil || err.Error() != "disk full" {
+		t.Errorf("bad error in fallback mode: %v", err)
+	}
+	if got := fallback.String(); got != "INFO two\nINFO three\n" {
+		t.Errorf("bad fallback output: %q", got)
+	}
+	if strings.Join(failed, ";") != "one: disk full;two: disk full" {
+		t.Errorf("bad reported errors: %q", failed)
+	}
+	if state := log.ErrorState(); state.Errors != 2 || state.Consecutive != 2 ||
+		!state.Fallback || state.FallbackWrites != 2 || state.Skipped != 1 ||
+		state.LastError == nil {
+		t.Errorf("bad state: %+v", state)
+	}
+	// основной поток восстановлен
+	log.errs.retry = time.Time{}
+	log.SetOutput(out)
+	log.Info("four")
+	if out.String() != "INFO four\n" || log.ErrorState().Fallback {
+		t.Errorf("primary output not restored: %q", out.String())
+	}
+
+	// без резервного потока переключение не выполняется
+	failed = nil
+	log.SetOutput(failWriter{})
+	log.SetFallback(nil, 2)
+	for i := 0; i < 3; i++ {
+		if err := log.Write(INFO, "", "lost", nil); err == nil {
+			t.Error("expected error")
+		}
+	}
+	if state := log.ErrorState(); state.Errors != 5 || state.Consecutive != 3 ||
+		state.Fallback || state.FallbackWrites != 2 || state.Skipped != 1 {
+		t.Errorf("bad state without fallback: %+v", state)
+	}
+	if len(failed) != 3 {
+		t.Errorf("bad reported errors: %q", failed)
+	}
+	failed = nil
+
+	fallback.Reset()
+	var f = NewFailsafe(NewWriter(failWriter{}, INFO, new(Console)),
+		NewWriter(fallback, INFO, new(Console)), 1)
+	f.SetErrorHandler(func(err error, lvl Level, category, msg string) {
+		failed = append(failed, msg)
+	})
+	f.New("db").Warn("query")
+	f.Debug("skipped")
+	if err := f.Write(INFO, "", "next", nil); err == nil {
+		t.Error("error not reported in fallback mode")
+	}
+	if got := fallback.String(); got != "WARN [db]: query\nINFO next\n" {
+		t.Errorf("bad fallback output: %q", got)
+	}
+	if state := f.ErrorState(); state.Errors != 1 || !state.Fallback ||
+		state.Skipped != 1 || len(failed) != 1 {
+		t.Errorf("bad state: %+v", state)
+	}
+}
@@ -0,0 +1,128 @@
+package log
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// fieldKind задает тип значения дополнительного поля, сформированного с
+// помощью типизированных конструкторов.
+type fieldKind uint8
+
+const (
+	anyKind      fieldKind = iota // значение в Value
+	stringKind                    // строка в str
+	int64Kind                     // целое число в num
+	uint64Kind                    // беззнаковое целое в num
+	float64Kind                   // биты числа с плавающей точкой в num
+	boolKind                      // 0 или 1 в num
+	durationKind                  // интервал в наносекундах в num
+	timeKind                      // наносекунды в num, *time.Location в Value
+	errorKind                     // ошибка в Value
+	stringerKind                  // fmt.Stringer в Value
+	objectKind                    // произвольный объект в Value
+	groupKind                     // группа полей fieldGroup в Value
+)
+
+// String возвращает строковое поле.
+func String(name, value string) Field {
+	return Field{Name: name, kind: stringKind, str: value}
+}
+
+// Int64 возвращает поле с целым числом.
+func Int64(name string, value int64) Field {
+	return Field{Name: name, kind: int64Kind, num: uint64(value)}
+}
+
+// Uint64 возвращает поле с беззнаковым целым числом.
+func Uint64(name string, value uint64) Field {
+	return Field{Name: name, kind: uint64Kind, num: value}
+}
+
+// Float64 возвращает поле с числом с плавающей точкой.
+func Float64(name string, value float64) Field {
+	return Field{Name: name, kind: float64Kind, num: math.Float64bits(value)}
+}
+
+// Bool возвращает поле с логическим значением.
+func Bool(name string, value bool) Field {
+	var num uint64
+	if value {
+		num = 1
+	}
+	return Field{Name: name, kind: boolKind, num: num}
+}
+
+// Duration возвращает поле с интервалом времени.
+func Duration(name string, value time.Duration) Field {
+	return Field{Name: name, kind: durationKind, num: uint64(value)}
+}
+
+// Time возвращает поле с датой и временем. Время за пределами диапазона,
+// представимого в наносекундах (1678-2262 годы), сохраняется как есть.
+func Time(name string, value time.Time) Field {
+	if value.IsZero() {
+		return Field{Name: name, kind: timeKind}
+	}
+	if year := value.Year(); year < 1678 || year > 2261 {
+		return Field{Name: name, Value: value}
+	}
+	return Field{Name: name, kind: timeKind, num: uint64(value.UnixNano()),
+		Value: value.Location()}
+}
+
+// Err возвращает поле "error" с описанием ошибки.
+func Err(err error) Field {
+	return Field{Name: "error", kind: errorKind, Value: err}
+}
+
+// Any возвращает поле с произвольным значением.
+func Any(name string, value interface{}) Field {
+	return Field{Name: name, Value: value}
+}
+
+// Stringer возвращает поле, значение которого будет получено вызовом метода
+// String только при выводе записи в лог.
+func Stringer(name string, value fmt.Stringer) Field {
+	return Field{Name: name, kind: stringerKind, Value: value}
+}
+
+// Object возвращает поле с вложенным объектом, который выводится в виде
+// структуры, а не строки. Если объект поддерживает ObjectMarshaler, то он
+// сам описывает свои поля, в противном случае для JSON используется
+// encoding/json.
+func Object(name string, value interface{}) Field {
+	return Field{Name: name, kind: objectKind, Value: value}
+}
+
+// Interface возвращает значение поля в виде interface{}. Для полей,
+// созданных типизированными конструкторами, это приводит к выделению памяти.
+func (f Field) Interface() interface{} {
+	switch f.kind {
+	case stringKind:
+		return f.str
+	case int64Kind:
+		return int64(f.num)
+	case uint64Kind:
+		return f.num
+	case float64Kind:
+		return math.Float64frombits(f.num)
+	case boolKind:
+		return f.num != 0
+	case durationKind:
+		return time.Duration(f.num)
+	case timeKind:
+		return f.time()
+	default:
+		return f.Value
+	}
+}
+
+// time возвращает значение поля с типом timeKind.
+func (f Field) time() time.Time {
+	if f.Value == nil {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(f.num)).In(f.Value.(*time.Location))
+}
@@ -0,0 +1,100 @@
+package log
+
+import "fmt"
+
+// WithTemplate возвращает раздел лога, который для сообщений, заданных с
+// помощью форматирования (Infof, Errorf и т.д.), дополнительно сохраняет
+// строку формата в поле "msg_template", а аргументы в поле "msg_args". Это
+// позволяет группировать однотипные сообщения в системах анализа логов.
+func (l *Logger) WithTemplate() *Logger {
+	return &Logger{
+		h:      l.h,
+		name:   l.name,
+		fields: l.fields,
+		groups: l.groups,
+		tmpl:   true,
+	}
+}
+
+// Logf записывает в лог сообщение с указанным уровнем, сформированное по
+// правилам fmt.Sprintf. Форматирование выполняется только в том случае, если
+// сообщение будет выведено в лог.
+func (l *Logger) Logf(lvl Level, format string, args ...interface{}) {
+	l.logf(lvl, format, args)
+}
+
+// Tracef записывает в лог форматированное сообщение с уровнем ниже
+// отладочного.
+func (l *Logger) Tracef(format string, args ...interface{}) {
+	l.logf(TRACE, format, args)
+}
+
+// Debugf записывает в лог форматированное отладочное сообщение.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(DEBUG, format, args)
+}
+
+// Infof записывает в лог форматированное информационное сообщение.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(INFO, format, args)
+}
+
+// Warnf записывает в лог форматированное сообщение с предупреждением.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(WARN, format, args)
+}
+
+// Errorf записывает в лог форматированное сообщение с ошибкой.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(ERROR, format, args)
+}
+
+// Panicf записывает в лог форматированное сообщение с уровнем PANIC и
+// вызывает panic с текстом сообщения.
+func (l *Logger) Panicf(format string, args ...interface{}) {
+	var msg = fmt.Sprintf(format, args...)
+	if enabled(l.h, PANIC, l.name) {
+		l.writef(PANIC, format, msg, args)
+	}
+	panic(msg)
+}
+
+// Fatalf записывает в лог форматированное сообщение с критической ошибкой и
+// завершает приложение так же, как Fatal.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.logf(FATAL, format, args)
+	exit(l.h)
+}
+
+// logf форматирует и записывает сообщение в лог, если оно будет выведено.
+func (l *Logger) logf(lvl Level, format string, args []interface{}) {
+	if !enabled(l.h, lvl, l.name) {
+		return
+	}
+	l.writef(lvl, format, fmt.Sprintf(format, args...), args)
+}
+
+// writef записывает в лог отформатированное сообщение msg, добавляя при
+// необходимости поля с шаблоном и аргументами.
+func (l *Logger) writef(lvl Level, format, msg string, args []interface{}) {
+	if !l.tmpl {
+		l.h.Write(lvl, l.name, msg, l.fields)
+		return
+	}
+	// поля шаблона добавляются на верхний уровень, вне открытых групп
+	var list = getFields()
+	*list = append(append(*list, l.fields...), String("msg_template", format),
+		Array("msg_args", formatArgs(args)))
+	l.h.Write(lvl, l.name, msg, *list)
+	putFields(list)
+}
+
+// formatArgs описывает аргументы форматированного сообщения.
+type formatArgs []interface{}
+
+// MarshalLogArray поддерживает интерфейс ArrayMarshaler.
+func (a formatArgs) MarshalLogArray(enc ArrayEncoder) {
+	for _, arg := range a {
+		enc.Append(Any("", arg))
+	}
+}
@@ -0,0 +1,52 @@
+package log
+
+// Group возвращает поле, объединяющее несколько полей в группу с указанным
+// именем. В JSON группа выводится в виде вложенного объекта, а в Console и
+// Color в виде пар "group.key=value". Группы без полей не выводятся.
+func Group(name string, fields ...Field) Field {
+	return Field{Name: name, kind: groupKind, Value: fieldGroup(fields)}
+}
+
+// fieldGroup описывает список полей группы.
+type fieldGroup []Field
+
+// MarshalLogObject поддерживает интерфейс ObjectMarshaler.
+func (g fieldGroup) MarshalLogObject(enc ObjectEncoder) {
+	enc.Add(g...)
+}
+
+// group возвращает список полей, если поле является группой.
+func (f Field) group() (fieldGroup, bool) {
+	if f.kind != groupKind {
+		return nil, false
+	}
+	group, _ := f.Value.(fieldGroup)
+	return group, true
+}
+
+// Group возвращает новый раздел лога, все последующие дополнительные поля
+// которого будут помещены в группу с указанным именем. Поля с одинаковыми
+// именами заменяют друг друга только внутри одной группы.
+func (l *Logger) Group(name string) *Logger {
+	return &Logger{
+		h:      l.h,
+		name:   l.name,
+		fields: nest(l.fields, l.groups, []Field{Group(name)}),
+		groups: l.groups + 1,
+		tmpl:   l.tmpl,
+	}
+}
+
+// nest возвращает копию списка полей, добавляя новые поля в последнюю
+// открытую группу указанного уровня вложенности.
+func nest(fields []Field, depth int, add []Field) []Field {
+	var result = make([]Field, len(fields), len(fields)+len(add))
+	copy(result, fields)
+	if depth == 0 || len(result) == 0 {
+		return append(result, add...)
+	}
+	var last = &result[len(result)-1] // открытая группа всегда последняя
+	group, _ := last.group()
+	last.Value = fieldGroup(nest(group, depth-1, add))
+	return result
+}
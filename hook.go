@@ -0,0 +1,69 @@
+package log
+
+import "strings"
+
+// Hook описывает функцию, которая вызывается обработчиком Writer для каждой
+// записи лога непосредственно перед её форматированием. Функция может
+// изменить запись: добавить, удалить или переписать дополнительные поля,
+// изменить текст сообщения или уровень. Если функция возвращает false, то
+// запись отбрасывается и в лог не выводится.
+type Hook func(entry *Entry) bool
+
+// AddFields возвращает Hook, добавляющий к каждой записи лога указанные
+// дополнительные поля, например, имя хоста, идентификатор процесса или версию
+// приложения. Поля задаются по тем же правилам, что и для Logger.With. Если
+// поле с таким же именем уже задано в записи, то оно не переопределяется.
+func AddFields(fields ...interface{}) Hook {
+	var list = new(Logger).with(fields)
+	return func(entry *Entry) bool {
+		for _, field := range list {
+			if _, ok := entry.Get(field.Name); !ok {
+				entry.Fields = append(entry.Fields, field)
+			}
+		}
+		return true
+	}
+}
+
+// Escalate возвращает Hook, повышающий уровень записей лога с указанным
+// текстом сообщения до lvl. Записи с уровнем выше lvl не изменяются.
+func Escalate(lvl Level, messages ...string) Hook {
+	return func(entry *Entry) bool {
+		if entry.Level >= lvl {
+			return true
+		}
+		for _, msg := range messages {
+			if entry.Message == msg {
+				entry.Level = lvl
+				break
+			}
+		}
+		return true
+	}
+}
+
+// Redact возвращает Hook, заменяющий значения полей с указанными именами на
+// "***", в том числе внутри групп полей. Имена полей сравниваются без учета
+// регистра.
+func Redact(names ...string) Hook {
+	var hidden = make(map[string]bool, len(names))
+	for _, name := range names {
+		hidden[strings.ToLower(name)] = true
+	}
+	var redact func(fields []Field) []Field
+	redact = func(fields []Field) []Field {
+		for i, field := range fields {
+			if hidden[strings.ToLower(field.Name)] {
+				fields[i] = String(field.Name, "***")
+			} else if group, ok := field.group(); ok {
+				// группа может использоваться несколькими записями
+				fields[i].Value = fieldGroup(redact(append(fieldGroup(nil), group...)))
+			}
+		}
+		return fields
+	}
+	return func(entry *Entry) bool {
+		entry.Fields = redact(entry.Fields)
+		return true
+	}
+}
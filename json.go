@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"time"
 )
@@ -11,9 +12,10 @@ import (
 // JSON формирует запись в лог в формате JSON.
 type JSON struct{}
 
-// Encode возвращает представление записи в лог в формате JSON.
-func (f JSON) Encode(entry *Entry) []byte {
-	var buf = buffer(buffers.Get().([]byte)[:0]) // получаем и сбрасываем буфер
+// Encode добавляет к dst представление записи в лог в формате JSON и
+// возвращает результат.
+func (f JSON) Encode(dst []byte, entry *Entry) []byte {
+	var buf = buffer(dst)
 	buf.WriteString(`{"ts":`)
 	if entry.Timestamp.IsZero() {
 		entry.Timestamp = time.Now()
@@ -23,72 +25,17 @@ func (f JSON) Encode(entry *Entry) []byte {
 	buf = strconv.AppendInt(buf, int64(entry.Level), 10)
 	if entry.Category != "" {
 		buf.WriteString(`,"log":`)
-		buf.WriteQuote(entry.Category)
+		buf.WriteJSON(entry.Category)
 	}
 	if entry.Message != "" {
 		buf.WriteString(`,"msg":`)
-		buf.WriteQuote(entry.Message)
+		buf.WriteJSON(entry.Message)
 	}
 	for _, field := range entry.Fields {
 		buf.WriteByte(',')
-		buf.WriteQuote(field.Name)
+		buf.WriteJSON(field.Name)
 		buf.WriteByte(':')
-		switch value := field.Value.(type) {
-		case nil:
-			buf.WriteString("null")
-		case string:
-			buf.WriteQuote(value)
-		case []byte:
-			buf.WriteQuote(base64.StdEncoding.EncodeToString(value))
-		case error:
-			if value == nil {
-				buf.WriteString("null")
-			} else {
-				buf.WriteQuote(value.Error())
-			}
-		case bool:
-			buf = strconv.AppendBool(buf, value)
-		case int:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int8:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int16:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int32:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case int64:
-			buf = strconv.AppendInt(buf, value, 10)
-		case uint:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint8:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint16:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint32:
-			buf = strconv.AppendUint(buf, uint64(value), 10)
-		case uint64:
-			buf = strconv.AppendUint(buf, value, 10)
-		case float32:
-			buf = strconv.AppendFloat(buf, float64(value), 'g', -1, 32)
-		case float64:
-			buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
-		case time.Time:
-			if value.IsZero() {
-				buf.WriteString(`""`)
-			} else {
-				buf = value.AppendFormat(buf, time.RFC3339)
-			}
-		case time.Duration:
-			buf = strconv.AppendInt(buf, int64(value), 10)
-		case fmt.Stringer:
-			buf.WriteQuote(value.String())
-		default:
-			if data, err := json.Marshal(value); err == nil {
-				buf = append(buf, data...)
-			} else {
-				buf.WriteQuote(fmt.Sprint(value))
-			}
-		}
+		buf = f.appendValue(buf, field)
 	}
 	// // для предупреждений и ошибок добавляем информацию об исходном файле
 	// if entry.Level >= WARN {
@@ -106,3 +53,143 @@ func (f JSON) Encode(entry *Entry) []byte {
 	buf.WriteString("}\n")
 	return buf
 }
+
+// appendValue добавляет в буфер значение дополнительного поля.
+func (f JSON) appendValue(buf buffer, field Field) buffer {
+	if obj, ok := field.object(); ok {
+		var enc = jsonObject{enc: f, buf: buf}
+		enc.buf.WriteByte('{')
+		obj.MarshalLogObject(&enc)
+		enc.buf.WriteByte('}')
+		return enc.buf
+	}
+	if arr, ok := field.array(); ok {
+		var enc = jsonObject{enc: f, buf: buf}
+		enc.buf.WriteByte('[')
+		arr.MarshalLogArray(&enc)
+		enc.buf.WriteByte(']')
+		return enc.buf
+	}
+	switch field.kind {
+	case stringKind:
+		buf.WriteJSON(field.str)
+		return buf
+	case int64Kind:
+		return strconv.AppendInt(buf, int64(field.num), 10)
+	case uint64Kind:
+		return strconv.AppendUint(buf, field.num, 10)
+	case float64Kind:
+		return strconv.AppendFloat(buf, math.Float64frombits(field.num), 'g', -1, 64)
+	case boolKind:
+		return strconv.AppendBool(buf, field.num != 0)
+	case durationKind:
+		buf.WriteJSON(time.Duration(field.num).String())
+		return buf
+	case timeKind:
+		if field.Value == nil {
+			buf.WriteString(`""`)
+			return buf
+		}
+		buf.WriteByte('"')
+		buf = field.time().AppendFormat(buf, time.RFC3339)
+		buf.WriteByte('"')
+		return buf
+	case objectKind:
+		if data, err := json.Marshal(field.Value); err == nil {
+			return append(buf, data...)
+		}
+		buf.WriteJSON(fmt.Sprint(field.Value))
+		return buf
+	}
+	// ошибки, fmt.Stringer и значения без указания типа
+	switch value := field.Value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case string:
+		buf.WriteJSON(value)
+	case []byte:
+		buf.WriteJSON(base64.StdEncoding.EncodeToString(value))
+	case error:
+		if value == nil {
+			buf.WriteString("null")
+		} else {
+			buf.WriteJSON(value.Error())
+		}
+	case bool:
+		buf = strconv.AppendBool(buf, value)
+	case int:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int8:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int16:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int32:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int64:
+		buf = strconv.AppendInt(buf, value, 10)
+	case uint:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint8:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint16:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint32:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint64:
+		buf = strconv.AppendUint(buf, value, 10)
+	case float32:
+		buf = strconv.AppendFloat(buf, float64(value), 'g', -1, 32)
+	case float64:
+		buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
+	case time.Time:
+		if value.IsZero() {
+			buf.WriteString(`""`)
+		} else {
+			buf.WriteByte('"')
+			buf = value.AppendFormat(buf, time.RFC3339)
+			buf.WriteByte('"')
+		}
+	case time.Duration:
+		buf.WriteJSON(value.String())
+	case fmt.Stringer:
+		buf.WriteJSON(value.String())
+	default:
+		if data, err := json.Marshal(value); err == nil {
+			buf = append(buf, data...)
+		} else {
+			buf.WriteJSON(fmt.Sprint(value))
+		}
+	}
+	return buf
+}
+
+// jsonObject поддерживает вывод вложенных объектов и массивов в формате JSON.
+type jsonObject struct {
+	enc JSON   // формат вывода значений
+	buf buffer // буфер для вывода
+	n   int    // количество выведенных элементов
+}
+
+// Add добавляет поля объекта.
+func (o *jsonObject) Add(fields ...Field) {
+	for _, field := range fields {
+		if o.n > 0 {
+			o.buf.WriteByte(',')
+		}
+		o.buf.WriteJSON(field.Name)
+		o.buf.WriteByte(':')
+		o.buf = o.enc.appendValue(o.buf, field)
+		o.n++
+	}
+}
+
+// Append добавляет элементы массива.
+func (o *jsonObject) Append(values ...Field) {
+	for _, value := range values {
+		if o.n > 0 {
+			o.buf.WriteByte(',')
+		}
+		o.buf = o.enc.appendValue(o.buf, value)
+		o.n++
+	}
+}
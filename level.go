@@ -1,5 +1,14 @@
 package log
 
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
 // Level задает уровень записи лога.
 type Level int8
 
@@ -13,29 +22,213 @@ const (
 	FATAL                         // 96
 )
 
-// String возвращает название группы уровней записи лога:
-//  ""      [-128...-65]
-//  "TRACE" [-64...-33]
-//  "DEBUG" [-32...-1]
-//  "INFO"  [0...31]
-//  "WARN"  [32...63]
-//  "ERROR" [64...95]
-//  "FATAL" [96...127]
+// PANIC задает уровень сообщений, после вывода которых вызывается panic.
+const PANIC Level = ERROR + 16 // 80
+
+// LevelInfo описывает свойства именованного уровня записи лога.
+type LevelInfo struct {
+	Name   string // название, например "NOTICE"
+	Short  string // короткое название, например "NTC"
+	Color  string // параметры цвета ANSI для Color, например "96" или "38;5;208"
+	Syslog int    // уровень важности syslog (0-7)
+	OTel   int    // уровень важности OpenTelemetry SeverityNumber (1-24)
+}
+
+// levelRegistry описывает список именованных уровней. При регистрации нового
+// уровня создается новая копия списка, поэтому для чтения блокировка не
+// требуется.
+type levelRegistry struct {
+	levels []Level             // уровни в порядке возрастания
+	info   map[Level]LevelInfo // свойства уровней
+	names  map[string]Level    // названия уровней в нижнем регистре
+}
+
+var (
+	levelsMu sync.Mutex
+	levels   atomic.Value // *levelRegistry
+)
+
+// предопределенные уровни и дополнительные варианты их названий
+func init() {
+	levels.Store(&levelRegistry{
+		info:  map[Level]LevelInfo{},
+		names: map[string]Level{"all": -128, "*": -128, "none": 127, "off": 127},
+	})
+	for _, level := range []struct {
+		lvl     Level
+		info    LevelInfo
+		aliases []string
+	}{
+		{TRACE, LevelInfo{"TRACE", "TRC", "96", 7, 1}, []string{"t"}},
+		{DEBUG, LevelInfo{"DEBUG", "DBG", "94", 7, 5}, []string{"d"}},
+		{INFO, LevelInfo{"INFO", "INF", "92", 6, 9}, []string{"i"}},
+		{WARN, LevelInfo{"WARN", "WRN", "93", 4, 13}, []string{"warning", "w"}},
+		{ERROR, LevelInfo{"ERROR", "ERR", "91", 3, 17}, []string{"r"}},
+		{PANIC, LevelInfo{"PANIC", "PNC", "35", 2, 20}, []string{"p"}},
+		{FATAL, LevelInfo{"FATAL", "FTL", "35", 1, 21}, []string{"f"}},
+	} {
+		RegisterLevel(level.lvl, level.info, level.aliases...)
+	}
+	RegisterLevel(-128, LevelInfo{}, "a")
+	RegisterLevel(127, LevelInfo{}, "no", "n", "false")
+}
+
+// RegisterLevel регистрирует новый именованный уровень записи лога или
+// переопределяет свойства существующего. Уровень действует до следующего
+// зарегистрированного уровня: например, после регистрации NOTICE со
+// значением 16 уровни 16-31 будут называться NOTICE, а не INFO. Название,
+// короткое название и дополнительные названия уровня используются при
+// разборе уровня без учета регистра. Если название не указано, то
+// регистрируются только дополнительные названия.
+func RegisterLevel(lvl Level, info LevelInfo, aliases ...string) {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	var old = loadLevels()
+	var reg = &levelRegistry{
+		levels: make([]Level, 0, len(old.levels)+1),
+		info:   make(map[Level]LevelInfo, len(old.info)+1),
+		names:  make(map[string]Level, len(old.names)+len(aliases)+2),
+	}
+	for lvl, info := range old.info {
+		reg.info[lvl] = info
+	}
+	for name, lvl := range old.names {
+		reg.names[name] = lvl
+	}
+	if info.Name != "" {
+		if info.Short == "" {
+			info.Short = info.Name
+		}
+		if info.Color == "" {
+			info.Color = "37"
+		}
+		reg.info[lvl] = info
+		aliases = append(aliases, info.Name, info.Short)
+	}
+	for _, name := range aliases {
+		reg.names[strings.ToLower(name)] = lvl
+	}
+	for lvl := range reg.info {
+		reg.levels = append(reg.levels, lvl)
+	}
+	sort.Slice(reg.levels, func(i, j int) bool {
+		return reg.levels[i] < reg.levels[j]
+	})
+	levels.Store(reg)
+}
+
+// loadLevels возвращает текущий список именованных уровней.
+func loadLevels() *levelRegistry {
+	return levels.Load().(*levelRegistry)
+}
+
+// Info возвращает свойства именованного уровня, к которому относится
+// уровень. Для уровней ниже минимального именованного возвращаются свойства
+// минимального уровня.
+func (l Level) Info() LevelInfo {
+	var reg = loadLevels()
+	return reg.info[reg.group(l)]
+}
+
+// group возвращает именованный уровень, к которому относится уровень.
+func (l Level) group() Level {
+	return loadLevels().group(l)
+}
+
+// group возвращает именованный уровень, к которому относится уровень.
+func (r *levelRegistry) group(l Level) Level {
+	var i = sort.Search(len(r.levels), func(i int) bool {
+		return r.levels[i] > l
+	})
+	if i == 0 {
+		if len(r.levels) == 0 {
+			return l
+		}
+		return r.levels[0]
+	}
+	return r.levels[i-1]
+}
+
+// String возвращает название группы уровней записи лога. Каждый именованный
+// уровень действует до следующего. Для предопределенных уровней:
+//
+//	"TRACE" [...-33]
+//	"DEBUG" [-32...-1]
+//	"INFO"  [0...31]
+//	"WARN"  [32...63]
+//	"ERROR" [64...79]
+//	"PANIC" [80...95]
+//	"FATAL" [96...127]
+//
+// Для уровней ниже минимального именованного к названию добавляется
+// разница, например "TRACE-8".
 func (l Level) String() string {
-	switch l & -32 {
-	case FATAL:
-		return "FATAL"
-	case ERROR:
-		return "ERROR"
-	case WARN:
-		return "WARN"
-	case INFO:
-		return "INFO"
-	case DEBUG:
-		return "DEBUG"
-	case TRACE:
-		return "TRACE"
-	default:
-		return ""
+	var reg = loadLevels()
+	var group = reg.group(l)
+	var name = reg.info[group].Name
+	if l < group {
+		return name + strconv.Itoa(int(l)-int(group))
+	}
+	return name
+}
+
+// MarshalText поддерживает интерфейс encoding.TextMarshaler.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(levelName(l)), nil
+}
+
+// UnmarshalText поддерживает интерфейс encoding.TextUnmarshaler.
+func (l *Level) UnmarshalText(text []byte) error {
+	lvl, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = lvl
+	return nil
+}
+
+// ParseLevel возвращает уровень по его названию, короткому названию или
+// числовому значению. Регистр букв не учитывается. К названию может быть
+// добавлено смещение: "INFO+4" или "TRACE-8".
+func ParseLevel(name string) (Level, error) {
+	if lvl, ok := parseLevel(strings.ToLower(name)); ok {
+		return lvl, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// parseLevel возвращает уровень по его названию в нижнем регистре или
+// числовому значению.
+func parseLevel(name string) (Level, bool) {
+	var reg = loadLevels()
+	if lvl, ok := reg.names[name]; ok {
+		return lvl, true
+	}
+	if lvl, err := strconv.ParseInt(name, 10, 8); err == nil {
+		return Level(lvl), true
+	}
+	// название со смещением
+	if pos := strings.LastIndexAny(name, "+-"); pos > 0 {
+		lvl, ok := reg.names[name[:pos]]
+		offset, err := strconv.Atoi(name[pos:])
+		if ok && err == nil && int(lvl)+offset >= -128 && int(lvl)+offset <= 127 {
+			return lvl + Level(offset), true
+		}
+	}
+	return 0, false
+}
+
+// levelName возвращает название уровня для настроек Writer. Для уровней, не
+// совпадающих с именованными, возвращается их числовое значение.
+func levelName(lvl Level) string {
+	switch lvl {
+	case -128:
+		return "ALL"
+	case 127:
+		return "NONE"
+	}
+	if info, ok := loadLevels().info[lvl]; ok {
+		return info.Name
 	}
+	return strconv.Itoa(int(lvl))
 }
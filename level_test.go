@@ -0,0 +1,70 @@
+package log
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLevel(t *testing.T) {
+	const NOTICE = INFO + 16
+	var saved = loadLevels()
+	t.Cleanup(func() {
+		levelsMu.Lock()
+		levels.Store(saved)
+		levelsMu.Unlock()
+	})
+	RegisterLevel(NOTICE, LevelInfo{Name: "NOTICE", Short: "NTC", Color: "38;5;208",
+		Syslog: 5, OTel: 10})
+	for _, test := range []struct {
+		lvl  Level
+		name string
+	}{
+		{TRACE - 8, "TRACE-8"},
+		{DEBUG + 1, "DEBUG"},
+		{INFO + 15, "INFO"},
+		{NOTICE, "NOTICE"},
+		{WARN - 1, "NOTICE"},
+		{PANIC, "PANIC"},
+		{127, "FATAL"},
+	} {
+		if got := test.lvl.String(); got != test.name {
+			t.Errorf("%d: %q, want %q", test.lvl, got, test.name)
+		}
+	}
+	for _, test := range []struct {
+		name string
+		lvl  Level
+	}{
+		{"notice", NOTICE},
+		{"NTC", NOTICE},
+		{"Warning", WARN},
+		{"info+4", INFO + 4},
+		{"TRACE-8", TRACE - 8},
+		{"-100", -100},
+		{"all", -128},
+	} {
+		if lvl, err := ParseLevel(test.name); err != nil || lvl != test.lvl {
+			t.Errorf("%q: %v, %v, want %v", test.name, lvl, err, test.lvl)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("expected error")
+	}
+	var lvl Level
+	if err := lvl.UnmarshalText([]byte("ntc")); err != nil || lvl != NOTICE {
+		t.Errorf("bad unmarshal: %v, %v", lvl, err)
+	}
+	if text, _ := WARN.MarshalText(); string(text) != "WARN" {
+		t.Errorf("bad marshal: %s", text)
+	}
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, new(Console))
+	if err := w.Set("notice"); err != nil || !strings.HasPrefix(w.String(), "NOTICE,") {
+		t.Errorf("bad writer level: %v, %v", w.String(), err)
+	}
+	w.Log(NOTICE, "notice")
+	w.Info("skipped")
+	if got, want := out.String(), "NOTICE notice\n"; got != want {
+		t.Errorf("unexpected output: %q, want %q", got, want)
+	}
+}
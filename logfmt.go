@@ -0,0 +1,227 @@
+package log
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Logfmt формирует запись в лог в формате logfmt: в виде одной строки с
+// парами "key=value", разделенными пробелами. Время, уровень, раздел и текст
+// сообщения выводятся с ключами ts, lvl, log и msg. Поля вложенных объектов
+// и групп выводятся в виде "name.key=value", а элементы массивов в виде
+// "name.0=value". Значения, содержащие пробелы, кавычки, знак равенства или
+// управляющие символы, выводятся в кавычках.
+type Logfmt struct {
+	TimeFormat string // формат времени; по умолчанию RFC3339 с наносекундами
+	UTC        bool   // вывод даты и времени в UTC
+}
+
+// Encode добавляет к dst запись лога в формате logfmt и возвращает
+// результат.
+func (f Logfmt) Encode(dst []byte, entry *Entry) []byte {
+	var buf = buffer(dst)
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	var ts = entry.Timestamp
+	if f.UTC {
+		ts = ts.UTC()
+	}
+	var layout = f.TimeFormat
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	buf.WriteString("ts=")
+	var pos = len(buf)
+	buf = ts.AppendFormat(buf, layout)
+	if needLogfmtQuote(string(buf[pos:])) { // время с пробелами
+		var text = string(buf[pos:])
+		buf = strconv.AppendQuote(buf[:pos], text)
+	}
+	buf.WriteString(" lvl=")
+	buf = appendLogfmtString(buf, entry.Level.String())
+	if entry.Category != "" {
+		buf.WriteString(" log=")
+		buf = appendLogfmtString(buf, entry.Category)
+	}
+	if entry.Message != "" {
+		buf.WriteString(" msg=")
+		buf = appendLogfmtString(buf, entry.Message)
+	}
+	for _, field := range entry.Fields {
+		buf = f.appendField(buf, "", field)
+	}
+	buf.WriteByte('\n')
+	return buf
+}
+
+// appendField добавляет в буфер дополнительное поле. Поля вложенных
+// объектов и элементы массивов выводятся отдельными парами, к имени которых
+// добавляется префикс с именем объекта.
+func (f Logfmt) appendField(buf buffer, prefix string, field Field) buffer {
+	if obj, ok := field.object(); ok {
+		var enc = logfmtObject{enc: f, buf: buf, prefix: prefix + field.Name + "."}
+		obj.MarshalLogObject(&enc)
+		return enc.buf
+	}
+	if arr, ok := field.array(); ok {
+		var enc = logfmtObject{enc: f, buf: buf, prefix: prefix + field.Name + "."}
+		arr.MarshalLogArray(&enc)
+		return enc.buf
+	}
+	buf.WriteByte(' ')
+	buf = appendLogfmtKey(buf, prefix)
+	buf = appendLogfmtKey(buf, field.Name)
+	buf.WriteByte('=')
+	return f.appendValue(buf, field)
+}
+
+// appendValue добавляет в буфер значение дополнительного поля. Значение nil
+// выводится пустым, а пустая строка в виде "".
+func (f Logfmt) appendValue(buf buffer, field Field) buffer {
+	switch field.kind {
+	case stringKind:
+		return appendLogfmtString(buf, field.str)
+	case int64Kind:
+		return strconv.AppendInt(buf, int64(field.num), 10)
+	case uint64Kind:
+		return strconv.AppendUint(buf, field.num, 10)
+	case float64Kind:
+		return strconv.AppendFloat(buf, math.Float64frombits(field.num), 'g', -1, 64)
+	case boolKind:
+		return strconv.AppendBool(buf, field.num != 0)
+	case durationKind:
+		return appendLogfmtString(buf, time.Duration(field.num).String())
+	case timeKind:
+		if field.Value == nil {
+			buf.WriteString(`""`)
+			return buf
+		}
+		return field.time().AppendFormat(buf, time.RFC3339Nano)
+	case objectKind:
+		return appendLogfmtString(buf, fmt.Sprint(field.Value))
+	}
+	// ошибки, fmt.Stringer и значения без указания типа
+	switch value := field.Value.(type) {
+	case nil:
+	case string:
+		buf = appendLogfmtString(buf, value)
+	case error:
+		buf = appendLogfmtString(buf, value.Error())
+	case bool:
+		buf = strconv.AppendBool(buf, value)
+	case int:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int8:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int16:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int32:
+		buf = strconv.AppendInt(buf, int64(value), 10)
+	case int64:
+		buf = strconv.AppendInt(buf, value, 10)
+	case uint:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint8:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint16:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint32:
+		buf = strconv.AppendUint(buf, uint64(value), 10)
+	case uint64:
+		buf = strconv.AppendUint(buf, value, 10)
+	case float32:
+		buf = strconv.AppendFloat(buf, float64(value), 'g', -1, 32)
+	case float64:
+		buf = strconv.AppendFloat(buf, value, 'g', -1, 64)
+	case time.Time:
+		if value.IsZero() {
+			buf.WriteString(`""`)
+		} else {
+			buf = value.AppendFormat(buf, time.RFC3339Nano)
+		}
+	case time.Duration:
+		buf = appendLogfmtString(buf, value.String())
+	case fmt.Stringer:
+		buf = appendLogfmtString(buf, value.String())
+	default:
+		buf = appendLogfmtString(buf, fmt.Sprint(value))
+	}
+	return buf
+}
+
+// appendLogfmtString добавляет в буфер строковое значение, при необходимости
+// заключая его в кавычки.
+func appendLogfmtString(buf buffer, s string) buffer {
+	if needLogfmtQuote(s) {
+		return strconv.AppendQuote(buf, s)
+	}
+	buf.WriteString(s)
+	return buf
+}
+
+// needLogfmtQuote возвращает true, если значение необходимо выводить в
+// кавычках.
+func needLogfmtQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for i := 0; i < len(s); {
+		var c = s[i]
+		if c < utf8.RuneSelf {
+			if c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		var r, size = utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError || !strconv.IsPrint(r) {
+			return true
+		}
+		i += size
+	}
+	return false
+}
+
+// appendLogfmtKey добавляет в буфер имя поля, заменяя недопустимые в имени
+// символы на подчеркивание.
+func appendLogfmtKey(buf buffer, key string) buffer {
+	for i := 0; i < len(key); i++ {
+		var c = key[i]
+		if c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+			c = '_'
+		}
+		buf.WriteByte(c)
+	}
+	return buf
+}
+
+// logfmtObject поддерживает вывод вложенных объектов и массивов в формате
+// logfmt.
+type logfmtObject struct {
+	enc    Logfmt // формат вывода значений
+	buf    buffer // буфер для вывода
+	prefix string // префикс имен полей
+	n      int    // количество выведенных элементов массива
+}
+
+// Add добавляет поля объекта.
+func (o *logfmtObject) Add(fields ...Field) {
+	for _, field := range fields {
+		o.buf = o.enc.appendField(o.buf, o.prefix, field)
+	}
+}
+
+// Append добавляет элементы массива. В качестве имени элемента используется
+// его индекс.
+func (o *logfmtObject) Append(values ...Field) {
+	for _, value := range values {
+		value.Name = strconv.Itoa(o.n)
+		o.buf = o.enc.appendField(o.buf, o.prefix, value)
+		o.n++
+	}
+}
@@ -3,27 +3,71 @@ package log
 import (
 	"fmt"
 	"log"
+	"sync"
 )
 
-// Handler описывает интерфейс для записи лога.
+// Handler описывает интерфейс для записи лога. Обработчик не должен
+// сохранять ссылку на переданный ему список полей после завершения метода
+// Write. Обработчик может дополнительно поддерживать интерфейс Enabler.
 type Handler interface {
 	Write(lvl Level, category, msg string, fields []Field) error
 }
 
-// Field описывает дополнительное именованное поле лога.
+// Enabler описывает необязательный интерфейс обработчика лога, позволяющий
+// заранее узнать, будет ли выведена запись с указанным уровнем и разделом,
+// чтобы не формировать её без необходимости. Обработчики, не поддерживающие
+// этот интерфейс, принимают все записи.
+type Enabler interface {
+	Enabled(lvl Level, category string) bool
+}
+
+// enabled возвращает true, если обработчик примет запись с указанным
+// уровнем и разделом.
+func enabled(h Handler, lvl Level, category string) bool {
+	if e, ok := h.(Enabler); ok {
+		return e.Enabled(lvl, category)
+	}
+	return true
+}
+
+// Field описывает дополнительное именованное поле лога. Поля можно задавать
+// непосредственно или с помощью типизированных конструкторов String, Int64,
+// Bool и т.д., которые позволяют избежать выделения памяти под значение.
 type Field struct {
 	Name  string
 	Value interface{}
+	kind  fieldKind // тип значения для типизированных полей
+	num   uint64    // числовое значение типизированного поля
+	str   string    // строковое значение типизированного поля
 }
 
 // Fields описывает список дополнительных полей.
 type Fields = map[string]interface{}
 
+// LogValuer описывает интерфейс значения дополнительного поля, которое
+// вычисляется только непосредственно перед выводом записи в лог, т.е. после
+// проверки её уровня.
+type LogValuer interface {
+	LogValue() interface{}
+}
+
+// Lazy позволяет использовать функцию в качестве отложенно вычисляемого
+// значения дополнительного поля. Функции с такой же сигнатурой, переданные в
+// качестве значения поля, обрабатываются точно так же.
+type Lazy func() interface{}
+
+// LogValue возвращает результат выполнения функции.
+func (f Lazy) LogValue() interface{} {
+	return f()
+}
+
 // Logger описывает именованный раздел лога.
 type Logger struct {
 	h      Handler // обработчик лога
 	name   string  // название раздела
 	fields []Field // дополнительные поля
+	groups int     // количество открытых групп полей
+	tmpl   bool    // сохранять шаблон форматированных сообщений
 }
 
 // NewLogger возвращает новый лог с указанным обработчиком.
@@ -43,42 +87,85 @@ func (l *Logger) New(name string, fields ...interface{}) *Logger {
 		h:      l.h,
 		name:   name,
 		fields: l.with(fields),
+		groups: l.groups,
+		tmpl:   l.tmpl,
 	}
 }
 
+// Enabled возвращает true, если запись с указанным уровнем будет выведена в
+// лог. Используется для того, чтобы избежать лишних вычислений.
+func (l *Logger) Enabled(lvl Level) bool {
+	return enabled(l.h, lvl, l.name)
+}
+
 // Log добавляет запись в лог с указанным уровнем.
 func (l *Logger) Log(lvl Level, msg string, fields ...interface{}) {
-	l.h.Write(lvl, l.name, msg, l.with(fields))
+	l.write(lvl, msg, fields)
 }
 
 // Trace записывает в лог сообщение с уровнем ниже отладочного.
 func (l *Logger) Trace(msg string, fields ...interface{}) {
-	l.h.Write(TRACE, l.name, msg, l.with(fields))
+	l.write(TRACE, msg, fields)
 }
 
 // Debug записывает в лог отладочное сообщение.
 func (l *Logger) Debug(msg string, fields ...interface{}) {
-	l.h.Write(DEBUG, l.name, msg, l.with(fields))
+	l.write(DEBUG, msg, fields)
 }
 
 // Info записывает в лог информационное сообщение.
 func (l *Logger) Info(msg string, fields ...interface{}) {
-	l.h.Write(INFO, l.name, msg, l.with(fields))
+	l.write(INFO, msg, fields)
 }
 
 // Warn записывает в лог сообщение с предупреждением.
 func (l *Logger) Warn(msg string, fields ...interface{}) {
-	l.h.Write(WARN, l.name, msg, l.with(fields))
+	l.write(WARN, msg, fields)
 }
 
 // Error записывает в лог сообщение с ошибкой.
 func (l *Logger) Error(msg string, fields ...interface{}) {
-	l.h.Write(ERROR, l.name, msg, l.with(fields))
+	l.write(ERROR, msg, fields)
+}
+
+// Panic записывает в лог сообщение с уровнем PANIC и вызывает panic с
+// текстом сообщения. Паника вызывается даже в том случае, если запись не
+// была выведена в лог из-за ограничения по уровню.
+func (l *Logger) Panic(msg string, fields ...interface{}) {
+	l.write(PANIC, msg, fields)
+	panic(msg)
 }
 
-// Fatal записывает в лог сообщение с критической ошибкой.
+// Fatal записывает в лог сообщение с критической ошибкой, сбрасывает
+// буферизованные записи и завершает приложение с кодом, заданным
+// SetExitCode. Перед завершением вызываются функции, зарегистрированные с
+// помощью AtExit. Для вывода сообщения с уровнем FATAL без завершения
+// приложения используйте Log.
 func (l *Logger) Fatal(msg string, fields ...interface{}) {
-	l.h.Write(FATAL, l.name, msg, l.with(fields))
+	l.write(FATAL, msg, fields)
+	exit(l.h)
+}
+
+// LogFields добавляет запись в лог с указанным уровнем и дополнительными
+// полями. В отличие от Log, не требует преобразования полей в interface{} и
+// поэтому при использовании типизированных конструкторов полей не выделяет
+// память.
+func (l *Logger) LogFields(lvl Level, msg string, fields ...Field) {
+	if len(fields) == 0 {
+		l.h.Write(lvl, l.name, msg, l.fields)
+		return
+	}
+	if !enabled(l.h, lvl, l.name) {
+		return
+	}
+	if l.groups > 0 {
+		l.h.Write(lvl, l.name, msg, nest(l.fields, l.groups, fields))
+		return
+	}
+	var list = getFields()
+	*list = append(append(*list, l.fields...), fields...)
+	l.h.Write(lvl, l.name, msg, *list)
+	putFields(list)
 }
 
 // StdLog возвращает обертку лога в стандартный. В качестве параметров
@@ -101,16 +188,49 @@ func (l *Logger) With(fields ...interface{}) *Logger {
 		h:      l.h,
 		name:   l.name,
 		fields: l.with(fields),
+		groups: l.groups,
+		tmpl:   l.tmpl,
 	}
 }
 
+// write добавляет запись в лог. Для объединения полей используется
+// временный список из пула, поэтому обработчик не должен сохранять ссылку
+// на переданный ему список полей.
+func (l *Logger) write(lvl Level, msg string, fields []interface{}) {
+	if len(fields) == 0 {
+		l.h.Write(lvl, l.name, msg, l.fields)
+		return
+	}
+	if !enabled(l.h, lvl, l.name) {
+		return // не разбираем поля, если запись не будет выведена
+	}
+	if l.groups > 0 {
+		l.h.Write(lvl, l.name, msg, l.with(fields))
+		return
+	}
+	var list = getFields()
+	*list = appendFields(append(*list, l.fields...), fields)
+	l.h.Write(lvl, l.name, msg, *list)
+	putFields(list)
+}
+
 // with при любом изменении полей возвращает их объединенную копию. В противном
 // случае возвращает список как есть.
 func (l *Logger) with(fields []interface{}) []Field {
 	if len(fields) == 0 {
 		return l.fields // ничего нового не будет
 	}
-	var result []Field
+	if l.groups > 0 {
+		return nest(l.fields, l.groups, appendFields(nil, fields))
+	}
+	var result = make([]Field, len(l.fields), len(l.fields)+len(fields))
+	copy(result, l.fields)
+	return appendFields(result, fields)
+}
+
+// appendFields разбирает список параметров и добавляет полученные поля к
+// списку.
+func appendFields(result []Field, fields []interface{}) []Field {
 	// обрабатываем новые поля, добавляя их в список
 	for i := 0; i < len(fields); i++ {
 		var name string
@@ -123,12 +243,12 @@ func (l *Logger) with(fields []interface{}) []Field {
 			continue
 		case Fields: // поля уже является самостоятельным списком
 			for name, value := range val {
-				result = append(result, Field{name, value})
+				result = append(result, Field{Name: name, Value: value})
 			}
 			continue
 		case error: // для ошибок без имени поля используем поле "error"
 			if val != nil {
-				result = append(result, Field{"error", val})
+				result = append(result, Field{Name: "error", Value: val})
 			}
 			continue
 		case string: // название поля
@@ -143,7 +263,29 @@ func (l *Logger) with(fields []interface{}) []Field {
 		}
 		i++ // увеличиваем счетчик прочитанных
 		// читаем следующее значение в списке
-		result = append(result, Field{name, fields[i]})
+		result = append(result, Field{Name: name, Value: fields[i]})
 	}
-	return append(l.fields, result...)
+	return result
 }
+
+// getFields возвращает пустой временный список полей из пула.
+func getFields() *[]Field {
+	return fieldLists.Get().(*[]Field)
+}
+
+// putFields очищает временный список полей и возвращает его в пул.
+func putFields(list *[]Field) {
+	if cap(*list) > maxPoolFields {
+		return
+	}
+	for i := range *list {
+		(*list)[i] = Field{}
+	}
+	*list = (*list)[:0]
+	fieldLists.Put(list)
+}
+
+var fieldLists = sync.Pool{New: func() interface{} {
+	var list = make([]Field, 0, maxScanFields)
+	return &list
+}}
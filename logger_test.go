@@ -3,7 +3,11 @@ package log
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -32,6 +36,23 @@ func TestJSON(t *testing.T) {
 	log.With("a", "b").Warn("info message")
 }
 
+// oldEncoder описывает формат с интерфейсом предыдущих версий.
+type oldEncoder struct{}
+
+func (oldEncoder) Encode(entry *Entry) []byte {
+	return []byte(entry.Level.String() + " " + entry.Message + "\n")
+}
+
+func TestLegacyEncoder(t *testing.T) {
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, LegacyEncoder(oldEncoder{}))
+	w.Info("first")
+	w.Warn("second")
+	if got, want := out.String(), "INFO first\nWARN second\n"; got != want {
+		t.Errorf("unexpected output: %q, want %q", got, want)
+	}
+}
+
 func TestWriterColor(t *testing.T) {
 	w := NewWriter(os.Stderr, DEBUG, &Color{KeyIndent: 8})
 	log := w.New("test", "id", 4)
@@ -70,3 +91,540 @@ func TestWriterErrors(t *testing.T) {
 // 	log.Print("std message")
 // 	New("aaa", "1", "2").StdLog(DEBUG).Print("test message")
 // }
+
+func TestHooks(t *testing.T) {
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, new(Console))
+	w.AddHook(
+		AddFields("pid", 42),
+		Escalate(ERROR, "escalated"),
+		func(entry *Entry) bool { return entry.Message != "skip" },
+		func(entry *Entry) bool {
+			if entry.Message == "lower" {
+				entry.Level = DEBUG
+			}
+			return true
+		},
+	)
+	w.Info("escalated", "pid", 1)
+	w.Info("skip")
+	w.Info("lower")
+	if got, want := out.String(), "ERROR escalated pid=1\n"; got != want {
+		t.Errorf("unexpected output: %q, want %q", got, want)
+	}
+}
+
+func TestLazy(t *testing.T) {
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, new(Console))
+	var calls int
+	value := func() interface{} { calls++; return "value" }
+	w.Debug("skipped", "lazy", Lazy(value))
+	if calls != 0 {
+		t.Error("lazy value evaluated for filtered entry")
+	}
+	w.Info("written", "lazy", Lazy(value), "func", value)
+	if calls != 2 {
+		t.Errorf("lazy value evaluated %d times", calls)
+	}
+	if got, want := out.String(), "INFO written lazy=\"value\" func=\"value\"\n"; got != want {
+		t.Errorf("unexpected output: %q, want %q", got, want)
+	}
+	if w.Enabled(DEBUG, "") || !w.New("test").Enabled(ERROR) {
+		t.Error("bad enabled")
+	}
+}
+
+// handlerFunc описывает обработчик без метода Enabled.
+type handlerFunc func(lvl Level, category, msg string, fields []Field) error
+
+func (f handlerFunc) Write(lvl Level, category, msg string, fields []Field) error {
+	return f(lvl, category, msg, fields)
+}
+
+func TestHandlerWithoutEnabled(t *testing.T) {
+	var got []string
+	var h = handlerFunc(func(lvl Level, category, msg string, fields []Field) error {
+		got = append(got, msg)
+		return nil
+	})
+	log := NewLogger(h)
+	if !log.Enabled(TRACE) {
+		t.Error("handler without Enabled must accept all levels")
+	}
+	log.Trace("trace")
+	log.Tracef("%s", "tracef")
+	Multi(h, NewWriter(new(strings.Builder), ERROR, nil)).Write(DEBUG, "", "multi", nil)
+	if strings.Join(got, ",") != "trace,tracef,multi" {
+		t.Errorf("unexpected entries: %v", got)
+	}
+}
+
+func TestTypedFields(t *testing.T) {
+	ts := time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC)
+	fields := []interface{}{
+		String("str", "text"),
+		Int64("int", -5),
+		Uint64("uint", 7),
+		Float64("float", 1.5),
+		Bool("bool", true),
+		Duration("dur", time.Second),
+		Time("time", ts),
+		Err(errors.New("failed")),
+		Stringer("level", WARN),
+		Object("obj", []int{1, 2}),
+	}
+	for _, test := range []struct {
+		enc  Encoder
+		want string
+	}{
+		{new(Console), `INFO msg str="text" int=-5 uint=7 float=1.5 bool=true dur=1s time="2020-05-01 12:30:00" error="failed" level="WARN" obj=[1 2]` + "\n"},
+		{new(JSON), `"msg":"msg","str":"text","int":-5,"uint":7,"float":1.5,"bool":true,"dur":"1s","time":"2020-05-01T12:30:00Z","error":"failed","level":"WARN","obj":[1,2]}` + "\n"},
+	} {
+		var out = new(strings.Builder)
+		NewWriter(out, INFO, test.enc).Info("msg", fields...)
+		if got := out.String(); !strings.HasSuffix(got, test.want) {
+			t.Errorf("unexpected output:\n%s\nwant suffix:\n%s", got, test.want)
+		}
+	}
+}
+
+type testUser struct {
+	Name  string
+	Roles []string
+}
+
+func (u testUser) MarshalLogObject(enc ObjectEncoder) {
+	enc.Add(String("name", u.Name), Array("roles", testRoles(u.Roles)))
+}
+
+type testRoles []string
+
+func (r testRoles) MarshalLogArray(enc ArrayEncoder) {
+	for _, role := range r {
+		enc.Append(String("", role))
+	}
+}
+
+func TestMarshaler(t *testing.T) {
+	user := testUser{Name: "Bob", Roles: []string{"admin", "dev"}}
+	for _, test := range []struct {
+		enc  Encoder
+		want string
+	}{
+		{new(Console), `INFO msg user.name="Bob" user.roles=["admin" "dev"] users=[{name="Bob" roles=["admin" "dev"]}]` + "\n"},
+		{new(JSON), `"msg":"msg","user":{"name":"Bob","roles":["admin","dev"]},"users":[{"name":"Bob","roles":["admin","dev"]}]}` + "\n"},
+	} {
+		var out = new(strings.Builder)
+		NewWriter(out, INFO, test.enc).Info("msg", "user", user,
+			Array("users", testUsers{user}))
+		if got := out.String(); !strings.HasSuffix(got, test.want) {
+			t.Errorf("unexpected output:\n%s\nwant suffix:\n%s", got, test.want)
+		}
+	}
+	NewWriter(os.Stderr, INFO, &Color{KeyIndent: 6}).Info("msg", "user", user,
+		Array("users", testUsers{user}), "id", 1)
+}
+
+type testUsers []testUser
+
+func (u testUsers) MarshalLogArray(enc ArrayEncoder) {
+	for _, user := range u {
+		enc.Append(Object("", user))
+	}
+}
+
+func TestGroup(t *testing.T) {
+	for _, test := range []struct {
+		enc    Encoder
+		empty  string
+		nested string
+		want   string
+	}{
+		{new(Console),
+			`INFO  id=1 http.id=3` + "\n",
+			`INFO msg id=1 http.id=3 http.req.id=4` + "\n",
+			`INFO msg id=1 http.id=3 http.req.id=4 http.method="GET" http.db.id=5` + "\n"},
+		{new(JSON),
+			`"lvl":0,"id":1,"http":{"id":3}}` + "\n",
+			`"msg":"msg","id":1,"http":{"id":3,"req":{"id":4}}}` + "\n",
+			`"msg":"msg","id":1,"http":{"id":3,"req":{"id":4},"method":"GET","db":{"id":5}}}` + "\n"},
+	} {
+		var out = new(strings.Builder)
+		log := NewWriter(out, INFO, test.enc).With("id", 1)
+		http := log.Group("http").With("id", 2, "id", 3)
+		http.Group("empty").Info("")
+		if got := out.String(); !strings.HasSuffix(got, test.empty) {
+			t.Errorf("unexpected empty group output:\n%s\nwant suffix:\n%s", got, test.empty)
+		}
+		out.Reset()
+		http.Group("req").With("id", 4).Info("msg")
+		if got := out.String(); !strings.HasSuffix(got, test.nested) {
+			t.Errorf("unexpected nested group output:\n%s\nwant suffix:\n%s", got, test.nested)
+		}
+		out.Reset()
+		http.With(Group("req", Int64("id", 4))).Info("msg",
+			"method", "GET", Group("db", Int64("id", 5)))
+		if got := out.String(); !strings.HasSuffix(got, test.want) {
+			t.Errorf("unexpected output:\n%s\nwant suffix:\n%s", got, test.want)
+		}
+	}
+}
+
+func TestFatal(t *testing.T) {
+	var code int
+	var calls []string
+	SetExitFunc(func(c int) { code = c })
+	defer SetExitFunc(nil)
+	SetExitCode(3)
+	defer SetExitCode(1)
+	AtExit(func() { calls = append(calls, "first") })
+	AtExit(func() { calls = append(calls, "second") })
+	FlushAtExit(flushFunc(func() error {
+		calls = append(calls, "flush")
+		return nil
+	}))
+	defer func() { exitHooks, flushers = nil, nil }()
+
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, new(Console))
+	w.Fatal("fatal")
+	if code != 3 || strings.Join(calls, ",") != "flush,second,first" {
+		t.Errorf("bad exit: code %d, hooks %v", code, calls)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != "panic" {
+				t.Errorf("unexpected panic value: %v", r)
+			}
+		}()
+		w.Panic("panic")
+	}()
+	if got, want := out.String(), "FATAL fatal\nPANIC panic\n"; got != want {
+		t.Errorf("unexpected output: %q, want %q", got, want)
+	}
+	var formatted int
+	func() {
+		defer func() {
+			if r := recover(); r != "panic 1" {
+				t.Errorf("unexpected panic value: %v", r)
+			}
+		}()
+		w.Panicf("panic %v", stringerFunc(func() string {
+			formatted++
+			return strconv.Itoa(formatted)
+		}))
+	}()
+	if formatted != 1 || !strings.HasSuffix(out.String(), "PANIC panic 1\n") {
+		t.Errorf("bad Panicf: formatted %d times, output %q", formatted, out)
+	}
+}
+
+// flushFunc поддерживает интерфейс Flusher.
+type flushFunc func() error
+
+func (f flushFunc) Flush() error { return f() }
+
+type stringerFunc func() string
+
+func (f stringerFunc) String() string { return f() }
+
+func TestFormat(t *testing.T) {
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, new(JSON))
+	w.Debugf("skipped %v", stringerFunc(func() string {
+		t.Error("formatted filtered message")
+		return ""
+	}))
+	w.Infof("user %s logged in %d times", "bob", 3)
+	w.WithTemplate().Group("g").Warnf("failed: %v", errors.New("timeout"))
+	want := `"msg":"user bob logged in 3 times"}` + "\n"
+	want2 := `"msg":"failed: timeout","msg_template":"failed: %v","msg_args":["timeout"]}` + "\n"
+	if lines := strings.SplitAfter(out.String(), "\n"); len(lines) != 3 ||
+		!strings.HasSuffix(lines[0], want) || !strings.HasSuffix(lines[1], want2) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, new(Console))
+	func() {
+		defer w.Recover()
+		var m map[string]int
+		m["a"] = 1
+	}()
+	got := out.String()
+	if !strings.HasPrefix(got, "ERROR panic recovered panic=\"assignment to entry in nil map\" stack=[\"") ||
+		!strings.Contains(got, "TestRecover") {
+		t.Errorf("unexpected output: %s", got)
+	}
+}
+
+// chanWriter передает каждую запись в канал.
+type chanWriter chan string
+
+func (c chanWriter) Write(p []byte) (int, error) {
+	c <- string(p)
+	return len(p), nil
+}
+
+func TestRecoverGo(t *testing.T) {
+	var out = make(chanWriter, 1)
+	w := NewWriter(out, INFO, new(Console))
+	w.Go(func() { panic("boom") })
+	select {
+	case got := <-out:
+		if !strings.HasPrefix(got, `ERROR panic recovered panic="boom" stack=["`) {
+			t.Errorf("unexpected output: %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic in goroutine not logged")
+	}
+}
+
+func TestRecoverLevel(t *testing.T) {
+	var out = make(chanWriter, 1)
+	w := NewWriter(out, INFO, new(Console))
+	var repanicked = make(chan interface{}, 1)
+	go func() {
+		defer func() { repanicked <- recover() }()
+		defer w.RecoverLevel(WARN, true)
+		panic("boom")
+	}()
+	if r := <-repanicked; r != "boom" {
+		t.Errorf("unexpected repanic value: %v", r)
+	}
+	if got := <-out; !strings.HasPrefix(got, `WARN panic recovered panic="boom"`) {
+		t.Errorf("unexpected output: %s", got)
+	}
+
+	var code int
+	SetExitFunc(func(c int) { code = c })
+	defer SetExitFunc(nil)
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		defer w.RecoverLevel(FATAL, false)
+		panic("fatal")
+	}()
+	<-done
+	if got := <-out; code != 1 || !strings.HasPrefix(got, `FATAL panic recovered panic="fatal"`) {
+		t.Errorf("unexpected exit code %d, output: %s", code, got)
+	}
+}
+
+func TestRecoverHandler(t *testing.T) {
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, new(Console))
+	for _, test := range []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		body    string
+		logged  bool
+	}{
+		{"ok", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}, http.StatusOK, "ok", false},
+		{"panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}, http.StatusInternalServerError, "Internal Server Error\n", true},
+		{"written", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("partial"))
+			panic("boom")
+		}, http.StatusAccepted, "partial", true},
+	} {
+		out.Reset()
+		var rec = httptest.NewRecorder()
+		w.RecoverHandler(test.handler).ServeHTTP(rec,
+			httptest.NewRequest("GET", "/"+test.name, nil))
+		if rec.Code != test.status || rec.Body.String() != test.body {
+			t.Errorf("%s: unexpected response %d %q", test.name, rec.Code, rec.Body)
+		}
+		var want = `ERROR panic recovered method="GET" url="/` + test.name + `" panic="boom"`
+		if got := out.String(); strings.HasPrefix(got, want) != test.logged {
+			t.Errorf("%s: unexpected output: %s", test.name, got)
+		}
+	}
+
+	out.Reset()
+	func() {
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler {
+				t.Errorf("unexpected panic value: %v", r)
+			}
+		}()
+		w.RecoverHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic(http.ErrAbortHandler)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	if out.Len() != 0 {
+		t.Errorf("ErrAbortHandler logged: %s", out)
+	}
+}
+
+func TestWriterSet(t *testing.T) {
+	var out = new(strings.Builder)
+	w := NewWriter(out, INFO, new(Console))
+	if err := w.Set("warn,json,db=debug,db.conn=error,Api=trace"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := w.String(), "WARN,JSON,Api=TRACE,db=DEBUG,db.conn=ERROR"; got != want {
+		t.Errorf("bad config: %q, want %q", got, want)
+	}
+	for _, test := range []struct {
+		category string
+		lvl      Level
+		want     bool
+	}{
+		{"", INFO, false},
+		{"db", DEBUG, true},
+		{"db.query", DEBUG, true},
+		{"db.conn", WARN, false},
+		{"dbx", INFO, false},
+		{"Api.v1", TRACE, true},
+	} {
+		if got := w.Enabled(test.lvl, test.category); got != test.want {
+			t.Errorf("%q %v: enabled %v", test.category, test.lvl, got)
+		}
+	}
+	if err := w.Set("db=,bad"); err == nil {
+		t.Error("expected error")
+	}
+	if err := w.SetFor("trace,std,db=", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := w.String(), "TRACE,STD,time=2006-01-02 15:04:05,Api=TRACE,db.conn=ERROR"; got != want {
+		t.Errorf("bad temporary config: %q, want %q", got, want)
+	}
+	if err := w.SetFor("db=,bad", time.Millisecond); err == nil {
+		t.Error("expected error")
+	}
+	if err := w.SetFor("debug", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got, want := w.String(), "WARN,JSON,Api=TRACE,db=DEBUG,db.conn=ERROR"; got != want {
+		t.Errorf("bad reverted config: %q, want %q", got, want)
+	}
+	// восстанавливаются только настройки, измененные SetFor
+	if err := w.SetFor("db=trace", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Set("error,x=info"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got, want := w.String(), "ERROR,JSON,Api=TRACE,db=DEBUG,db.conn=ERROR,x=INFO"; got != want {
+		t.Errorf("bad partially reverted config: %q, want %q", got, want)
+	}
+	// String возвращает строку, которую можно передать в Set
+	w.SetFormat(&Console{TimeFormat: `Jan 2, 2006 "15:04"`})
+	var config = w.String()
+	if want := `ERROR,STD,time="Jan 2, 2006 \"15:04\"",Api=TRACE`; !strings.HasPrefix(config, want) {
+		t.Errorf("bad quoted config: %q, want prefix %q", config, want)
+	}
+	var w2 = NewWriter(new(strings.Builder), INFO, nil)
+	if err := w2.Set(config); err != nil {
+		t.Fatal(err)
+	}
+	if got := w2.String(); got != config {
+		t.Errorf("bad round trip: %q, want %q", got, config)
+	}
+	if err := w2.Set(`time="15:04`); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestColorTheme(t *testing.T) {
+	var ts = time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("MSK", 3*3600))
+	var entry = &Entry{Timestamp: ts, Level: INFO, Category: "db",
+		Message: "msg", Fields: []Field{Int64("n", 5)}}
+	var plain = Color{TimeFormat: time.RFC3339, UTC: true, Plain: true}
+	if got, want := string(plain.Encode(nil, entry)),
+		"2024-05-01T09:30:00Z INFO  [db]: msg n=5\n"; got != want {
+		t.Errorf("bad plain output: %q, want %q", got, want)
+	}
+	t.Setenv("FORCE_COLOR", "1")
+	var theme = Theme{Number: ANSI256(208), Levels: map[Level]string{
+		INFO: TrueColor(0, 128, 255)}}
+	var color = Color{TimeFormat: "15:04", Theme: &theme}
+	if got, want := string(color.Encode(nil, entry)),
+		"12:30 \x1b[7;38;2;0;128;255mINFO \x1b[0m [db]: msg n=\x1b[38;5;208m5\x1b[0m\n"; got != want {
+		t.Errorf("bad themed output: %q, want %q", got, want)
+	}
+	theme.Levels[INFO] = "" // уровень без цвета
+	if got, want := string(color.Encode(nil, entry)),
+		"12:30 INFO  [db]: msg n=\x1b[38;5;208m5\x1b[0m\n"; got != want {
+		t.Errorf("bad uncolored level: %q, want %q", got, want)
+	}
+
+	t.Setenv("FORCE_COLOR", "")
+	os.Unsetenv("FORCE_COLOR")
+	t.Setenv("NO_COLOR", "1")
+	if got := string(color.Encode(nil, entry)); strings.Contains(got, "\x1b") {
+		t.Errorf("color output with NO_COLOR: %q", got)
+	}
+	var w = NewWriter(new(strings.Builder), INFO, new(JSON))
+	if err := w.Set("auto"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.load().enc.(*Console); !ok {
+		t.Errorf("auto format: %T", w.load().enc)
+	}
+	if err := w.Set("dev,time=15:04"); err != nil {
+		t.Fatal(err)
+	}
+	if enc := w.load().enc.(*Color); !enc.Plain || enc.TimeFormat != "15:04" {
+		t.Errorf("bad color config: %+v", enc)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	var entry = &Entry{Level: INFO, Message: "line1\nINFO forged\x1b[2J",
+		Fields: []Field{String("s", "a\u202eb"), Any("v", "x\ty\u009b\xff")}}
+	var console = Console{}
+	if got, want := string(console.Encode(nil, entry)),
+		"INFO line1\\nINFO forged\\x1b[2J s=\"a\\u202eb\" v=\"x\\ty\\u009b\\xff\"\n"; got != want {
+		t.Errorf("bad console output: %q, want %q", got, want)
+	}
+	var color = Color{Plain: true, TimeFormat: "-"}
+	if got, want := string(color.Encode(nil, entry)),
+		"- INFO  line1\n    INFO forged\\x1b[2J s=a\\u202eb v=x\\ty\\u009b\\xff\n"; got != want {
+		t.Errorf("bad color output: %q, want %q", got, want)
+	}
+	console.Raw = true
+	if got, want := string(console.Encode(nil, &Entry{Level: INFO,
+		Message: "\x1b[1mbold\x1b[0m"})), "INFO \x1b[1mbold\x1b[0m\n"; got != want {
+		t.Errorf("bad raw output: %q, want %q", got, want)
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	var entry = &Entry{
+		Timestamp: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		Level:     ERROR,
+		Message:   "request failed",
+		Fields: []Field{String("path", "/"), String("empty", ""), Any("nil", nil),
+			Duration("took", 1500*time.Millisecond), Err(errors.New("bad \"x\"")),
+			Group("user", String("name", "Bob Smith"), Int64("id", 7))},
+	}
+	if got, want := string(Logfmt{}.Encode(nil, entry)),
+		`ts=2024-05-01T12:30:00Z lvl=ERROR msg="request failed" path=/ empty="" `+
+			`nil= took=1.5s error="bad \"x\"" user.name="Bob Smith" user.id=7`+"\n"; got != want {
+		t.Errorf("bad output: %q, want %q", got, want)
+	}
+	var layout = Logfmt{TimeFormat: "2006-01-02 15:04"}
+	if got := string(layout.Encode(nil, &Entry{Timestamp: entry.Timestamp,
+		Level: INFO})); got != "ts=\"2024-05-01 12:30\" lvl=INFO\n" {
+		t.Errorf("bad time output: %q", got)
+	}
+	// пробел появляется только в отформатированном времени
+	layout = Logfmt{TimeFormat: "Jan_2"}
+	if got := string(layout.Encode(nil, &Entry{Timestamp: entry.Timestamp,
+		Level: INFO})); got != "ts=\"May 1\" lvl=INFO\n" {
+		t.Errorf("bad padded time output: %q", got)
+	}
+}
@@ -0,0 +1,52 @@
+package log
+
+// ObjectEncoder описывает интерфейс, с помощью которого объект описывает свои
+// поля независимо от используемого формата лога. Для задания полей
+// используются те же конструкторы, что и для дополнительных полей записи.
+type ObjectEncoder interface {
+	Add(fields ...Field)
+}
+
+// ArrayEncoder описывает интерфейс, с помощью которого массив описывает свои
+// элементы независимо от используемого формата лога. Для задания элементов
+// используются конструкторы полей, при этом имена полей игнорируются.
+type ArrayEncoder interface {
+	Append(values ...Field)
+}
+
+// ObjectMarshaler описывает интерфейс объекта, который самостоятельно
+// описывает свои поля для вывода в лог. Такой объект выводится в JSON в виде
+// вложенного объекта, в Console в виде пар "name.key=value", а в Color в
+// виде блока с отступом.
+type ObjectMarshaler interface {
+	MarshalLogObject(enc ObjectEncoder)
+}
+
+// ArrayMarshaler описывает интерфейс массива, который самостоятельно
+// описывает свои элементы для вывода в лог.
+type ArrayMarshaler interface {
+	MarshalLogArray(enc ArrayEncoder)
+}
+
+// Array возвращает поле с вложенным массивом.
+func Array(name string, value ArrayMarshaler) Field {
+	return Field{Name: name, kind: objectKind, Value: value}
+}
+
+// object возвращает объект, если значение поля поддерживает ObjectMarshaler.
+func (f Field) object() (ObjectMarshaler, bool) {
+	if f.kind != anyKind && f.kind != objectKind && f.kind != groupKind {
+		return nil, false
+	}
+	obj, ok := f.Value.(ObjectMarshaler)
+	return obj, ok
+}
+
+// array возвращает массив, если значение поля поддерживает ArrayMarshaler.
+func (f Field) array() (ArrayMarshaler, bool) {
+	if f.kind != anyKind && f.kind != objectKind {
+		return nil, false
+	}
+	arr, ok := f.Value.(ArrayMarshaler)
+	return arr, ok
+}
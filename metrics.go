@@ -0,0 +1,218 @@
+package log
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metrics подсчитывает записи, передаваемые обработчику, по уровням и
+// разделам лога, а также количество ошибок записи. Если обработчик
+// отбрасывает часть записей (например, Sampler) и поддерживает метод
+// Dropped() uint64, то учитывается и количество отброшенных записей.
+//
+// Уровни учитываются по названию именованного уровня, к которому они
+// относятся. Количество учитываемых разделов ограничено: записи всех
+// остальных разделов учитываются вместе под названием OtherCategory.
+type Metrics struct {
+	h             Handler
+	maxCategories int
+	mu            sync.RWMutex
+	entries       map[metricKey]*uint64 // количество записей
+	failed        map[Level]*uint64     // количество ошибок записи
+	categories    map[string]bool       // учитываемые разделы
+}
+
+// metricKey описывает ключ для подсчета записей.
+type metricKey struct {
+	lvl      Level
+	category string
+}
+
+// OtherCategory задает название раздела, под которым учитываются записи
+// разделов, превысивших ограничение на их количество.
+const OtherCategory = "_other"
+
+// NewMetrics возвращает обработчик, подсчитывающий записи, передаваемые
+// обработчику h. Параметр maxCategories ограничивает количество отдельно
+// учитываемых разделов; если он не больше нуля, то используется 100.
+func NewMetrics(h Handler, maxCategories int) *Metrics {
+	if maxCategories <= 0 {
+		maxCategories = 100
+	}
+	return &Metrics{h: h, maxCategories: maxCategories,
+		entries:    make(map[metricKey]*uint64),
+		failed:     make(map[Level]*uint64),
+		categories: make(map[string]bool)}
+}
+
+// Enabled поддерживает интерфейс Enabler.
+func (m *Metrics) Enabled(lvl Level, category string) bool {
+	return enabled(m.h, lvl, category)
+}
+
+// Write учитывает запись и передает ее обработчику.
+func (m *Metrics) Write(lvl Level, category, msg string, fields []Field) error {
+	if !enabled(m.h, lvl, category) {
+		return nil
+	}
+	var group = lvl.group()
+	atomic.AddUint64(m.counter(group, category), 1)
+	err := m.h.Write(lvl, category, msg, fields)
+	if err != nil {
+		m.mu.RLock()
+		var n = m.failed[group]
+		m.mu.RUnlock()
+		if n == nil {
+			m.mu.Lock()
+			if n = m.failed[group]; n == nil {
+				n = new(uint64)
+				m.failed[group] = n
+			}
+			m.mu.Unlock()
+		}
+		atomic.AddUint64(n, 1)
+	}
+	return err
+}
+
+// counter возвращает счетчик записей для уровня и раздела.
+func (m *Metrics) counter(lvl Level, category string) *uint64 {
+	var key = metricKey{lvl, category}
+	m.mu.RLock()
+	var n = m.entries[key]
+	if n == nil && !m.categories[category] && len(m.categories) >= m.maxCategories {
+		key.category = OtherCategory
+		n = m.entries[key]
+	}
+	m.mu.RUnlock()
+	if n != nil {
+		return n
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.categories[key.category] {
+		if len(m.categories) >= m.maxCategories {
+			key.category = OtherCategory
+		} else {
+			m.categories[key.category] = true
+		}
+	}
+	if n = m.entries[key]; n == nil {
+		n = new(uint64)
+		m.entries[key] = n
+	}
+	return n
+}
+
+// Flush сбрасывает буферизованные записи обработчика.
+func (m *Metrics) Flush() error {
+	if f, ok := m.h.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// MetricsSnapshot содержит значения счетчиков Metrics на момент вызова
+// Snapshot.
+type MetricsSnapshot struct {
+	Entries map[string]map[string]uint64 `json:"entries"` // уровень -> раздел -> записи
+	Failed  map[string]uint64            `json:"failed"`  // уровень -> ошибки
+	Dropped uint64                       `json:"dropped"` // отброшенные записи
+}
+
+// Snapshot возвращает текущие значения счетчиков.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	var s = MetricsSnapshot{
+		Entries: make(map[string]map[string]uint64),
+		Failed:  make(map[string]uint64),
+	}
+	m.mu.RLock()
+	for key, n := range m.entries {
+		var name = key.lvl.String()
+		if s.Entries[name] == nil {
+			s.Entries[name] = make(map[string]uint64)
+		}
+		s.Entries[name][key.category] += atomic.LoadUint64(n)
+	}
+	for lvl, n := range m.failed {
+		s.Failed[lvl.String()] += atomic.LoadUint64(n)
+	}
+	m.mu.RUnlock()
+	if d, ok := m.h.(interface{ Dropped() uint64 }); ok {
+		s.Dropped = d.Dropped()
+	}
+	return s
+}
+
+// String возвращает значения счетчиков в формате JSON и поддерживает
+// интерфейс expvar.Var.
+func (m *Metrics) String() string {
+	data, _ := json.Marshal(m.Snapshot())
+	return string(data)
+}
+
+// Publish публикует значения счетчиков в expvar под указанным именем.
+// Как и expvar.Publish, вызывает panic, если имя уже используется.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, m)
+}
+
+// PrometheusHandler возвращает обработчик HTTP-запросов, выводящий значения
+// счетчиков в текстовом формате Prometheus: log_entries_total с метками
+// level и category, log_write_errors_total с меткой level и
+// log_dropped_total.
+func (m *Metrics) PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		var s = m.Snapshot()
+		var b strings.Builder
+		b.WriteString("# HELP log_entries_total Number of log entries by level and category.\n")
+		b.WriteString("# TYPE log_entries_total counter\n")
+		var levels = make([]string, 0, len(s.Entries))
+		for lvl := range s.Entries {
+			levels = append(levels, lvl)
+		}
+		sort.Strings(levels)
+		for _, lvl := range levels {
+			var categories = s.Entries[lvl]
+			var names = make([]string, 0, len(categories))
+			for name := range categories {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(&b, "log_entries_total{level=%s,category=%s} %d\n",
+					promLabel(lvl), promLabel(name), categories[name])
+			}
+		}
+		b.WriteString("# HELP log_write_errors_total Number of failed log writes by level.\n")
+		b.WriteString("# TYPE log_write_errors_total counter\n")
+		levels = levels[:0]
+		for lvl := range s.Failed {
+			levels = append(levels, lvl)
+		}
+		sort.Strings(levels)
+		for _, lvl := range levels {
+			fmt.Fprintf(&b, "log_write_errors_total{level=%s} %d\n",
+				promLabel(lvl), s.Failed[lvl])
+		}
+		b.WriteString("# HELP log_dropped_total Number of dropped log entries.\n")
+		b.WriteString("# TYPE log_dropped_total counter\n")
+		fmt.Fprintf(&b, "log_dropped_total %d\n", s.Dropped)
+		io.WriteString(w, b.String())
+	})
+}
+
+// promLabel возвращает значение метки Prometheus в кавычках.
+func promLabel(s string) string {
+	return `"` + promEscaper.Replace(s) + `"`
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
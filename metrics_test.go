@@ -0,0 +1,56 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestMetrics(t *testing.T) {
+	var w = NewWriter(io.Discard, DEBUG, new(JSON))
+	var m = NewMetrics(NewSampler(w, time.Hour, 2, 0), 2)
+	var log = &Logger{h: m}
+	for i := 0; i < 3; i++ {
+		log.New("db").Info("query")
+	}
+	log.New("http").Error("failed")
+	log.New("cache").Warn("miss")
+	log.New("queue").Warn("full")
+	log.Trace("filtered")
+	w.SetOutput(failWriter{})
+	log.New("db").Error("failed")
+
+	var s = m.Snapshot()
+	if s.Entries["INFO"]["db"] != 3 || s.Entries["ERROR"]["db"] != 1 ||
+		s.Entries["ERROR"]["http"] != 1 || s.Entries["WARN"][OtherCategory] != 2 {
+		t.Errorf("bad counts: %v", s.Entries)
+	}
+	if s.Failed["ERROR"] != 1 || s.Dropped != 1 {
+		t.Errorf("bad failed or dropped: %v %v", s.Failed, s.Dropped)
+	}
+	var parsed MetricsSnapshot
+	if err := json.Unmarshal([]byte(m.String()), &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	var rec = httptest.NewRecorder()
+	m.PrometheusHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`log_entries_total{level="INFO",category="db"} 3`,
+		`log_entries_total{level="WARN",category="_other"} 2`,
+		`log_write_errors_total{level="ERROR"} 1`,
+		`log_dropped_total 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, rec.Body)
+		}
+	}
+}
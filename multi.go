@@ -0,0 +1,48 @@
+package log
+
+// multiHandler передает записи лога сразу нескольким обработчикам.
+type multiHandler []Handler
+
+// Multi возвращает обработчик, передающий записи лога всем указанным
+// обработчикам. Запись передается обработчику только в том случае, если он
+// готов её принять. Возвращается первая из возникших ошибок.
+func Multi(handlers ...Handler) Handler {
+	return multiHandler(handlers)
+}
+
+// Enabled возвращает true, если хотя бы один из обработчиков примет запись.
+func (m multiHandler) Enabled(lvl Level, category string) bool {
+	for _, h := range m {
+		if enabled(h, lvl, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// Write передает запись всем обработчикам.
+func (m multiHandler) Write(lvl Level, category, msg string, fields []Field) error {
+	var result error
+	for _, h := range m {
+		if !enabled(h, lvl, category) {
+			continue
+		}
+		if err := h.Write(lvl, category, msg, fields); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// Flush сбрасывает буферизованные записи всех обработчиков.
+func (m multiHandler) Flush() error {
+	var result error
+	for _, h := range m {
+		if f, ok := h.(Flusher); ok {
+			if err := f.Flush(); err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
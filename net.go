@@ -0,0 +1,492 @@
+package log
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// NetWriter описывает поток вывода лога в сетевое соединение TCP, TLS или
+// unix socket, устойчивый к его разрывам. Записи сохраняются в очереди
+// ограниченного размера: в файле на диске или в памяти, и отправляются в
+// исходном порядке фоновой горутиной, поэтому медленный получатель не
+// задерживает запись в лог. При ошибке соединение восстанавливается в фоне
+// с увеличивающимся интервалом, а записи на это время остаются в очереди.
+// Если запись была отправлена частично, то после восстановления соединения
+// отправляется только ее оставшаяся часть.
+//
+// Если очередь переполнена, то запись отбрасывается и Write возвращает
+// ErrSpoolFull. Каждый вызов Write сохраняется в очереди как отдельная
+// запись.
+type NetWriter struct {
+	network string
+	address string
+	config  *tls.Config
+	mu      sync.Mutex
+	conn    net.Conn      // nil, пока соединение не установлено
+	spool   spool         // очередь записей
+	sent    int           // отправленная часть первой записи очереди
+	state   NetState      // текущее состояние
+	wake    chan struct{} // сообщает о новых записях в очереди
+	closed  chan bool     // закрывается при вызове Close
+	wg      sync.WaitGroup
+}
+
+// NetState описывает состояние NetWriter.
+type NetState struct {
+	Connected  bool      // соединение установлено и очередь пуста
+	Pending    int64     // размер записей в очереди
+	Dropped    uint64    // записи, отброшенные из-за переполнения очереди
+	Reconnects uint64    // количество установленных соединений
+	Err        error     // последняя ошибка соединения
+	Since      time.Time // время последнего изменения состояния соединения
+}
+
+// String возвращает краткое описание состояния.
+func (s NetState) String() string {
+	var state = "connected"
+	if !s.Connected {
+		state = "disconnected"
+		if s.Err != nil {
+			state += " (" + s.Err.Error() + ")"
+		}
+	}
+	return fmt.Sprintf("%s since %s, pending %d bytes, dropped %d, reconnects %d",
+		state, s.Since.Format(time.RFC3339), s.Pending, s.Dropped, s.Reconnects)
+}
+
+// ErrSpoolFull возвращается, если запись не может быть сохранена из-за
+// переполнения очереди.
+var ErrSpoolFull = errors.New("log: spool is full")
+
+// Параметры восстановления соединения.
+var (
+	netDialTimeout  = 10 * time.Second // время ожидания соединения
+	netWriteTimeout = 5 * time.Second  // время ожидания записи
+	netMinBackoff   = 100 * time.Millisecond
+	netMaxBackoff   = 30 * time.Second
+)
+
+// NewNetWriter возвращает поток вывода лога в соединение с указанным
+// адресом. Network задается так же, как для net.Dial: "tcp", "tcp4", "tcp6"
+// или "unix". Если config не nil, то используется TLS. Если задано имя файла
+// path, то очередь хранится в нем, и сохраненные в нем при предыдущем
+// запуске записи будут отправлены первыми; иначе очередь хранится в памяти.
+// Limit ограничивает размер очереди; если он не больше нуля, то
+// используется 16 МБ.
+//
+// Соединение устанавливается в фоне, поэтому ошибка возвращается только при
+// открытии файла очереди. Отправленные записи удаляются из файла очереди
+// по одной, поэтому при аварийном завершении во время отправки очереди
+// повторно может быть отправлена только одна запись.
+func NewNetWriter(network, address string, config *tls.Config, path string,
+	limit int64) (*NetWriter, error) {
+	if limit <= 0 {
+		limit = 16 << 20
+	}
+	var n = &NetWriter{
+		network: network,
+		address: address,
+		config:  config,
+		wake:    make(chan struct{}, 1),
+		closed:  make(chan bool),
+		state:   NetState{Since: time.Now()},
+	}
+	if path != "" {
+		spool, err := openFileSpool(path, limit)
+		if err != nil {
+			return nil, err
+		}
+		n.spool = spool
+	} else {
+		n.spool = &memSpool{limit: limit}
+	}
+	n.wg.Add(1)
+	go n.run()
+	return n, nil
+}
+
+// Write сохраняет запись в очереди на отправку.
+func (n *NetWriter) Write(p []byte) (int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	select {
+	case <-n.closed:
+		return 0, os.ErrClosed
+	default:
+	}
+	if err := n.spool.push(p); err != nil {
+		n.state.Dropped++
+		return 0, err
+	}
+	n.state.Connected = false // очередь не пуста
+	select {
+	case n.wake <- struct{}{}:
+	default: // отправка уже запрошена
+	}
+	return len(p), nil
+}
+
+// State возвращает текущее состояние.
+func (n *NetWriter) State() NetState {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var state = n.state
+	state.Pending = n.spool.size()
+	return state
+}
+
+// Sync сохраняет очередь на диск, если она хранится в файле.
+func (n *NetWriter) Sync() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.spool.sync()
+}
+
+// Close закрывает соединение и файл очереди. Не отправленные записи
+// остаются в файле очереди и будут отправлены при следующем запуске.
+func (n *NetWriter) Close() error {
+	n.mu.Lock()
+	select {
+	case <-n.closed:
+		n.mu.Unlock()
+		return nil
+	default:
+	}
+	close(n.closed)
+	if n.conn != nil {
+		n.conn.Close() // прерываем отправку
+	}
+	n.mu.Unlock()
+	n.wg.Wait() // дожидаемся завершения отправки
+	return n.spool.close()
+}
+
+// setError запоминает ошибку соединения.
+func (n *NetWriter) setError(err error) {
+	if n.state.Connected || n.state.Err == nil {
+		n.state.Since = time.Now()
+	}
+	n.state.Connected = false
+	n.state.Err = err
+}
+
+// run устанавливает соединение и отправляет записи из очереди, пока
+// NetWriter не закрыт. После ошибки соединение устанавливается повторно с
+// увеличивающимся интервалом.
+func (n *NetWriter) run() {
+	defer n.wg.Done()
+	var backoff = netMinBackoff
+	for {
+		if conn, err := n.dial(); err != nil {
+			n.mu.Lock()
+			n.setError(err)
+			n.mu.Unlock()
+		} else if !n.attach(conn) {
+			conn.Close()
+			return // NetWriter закрыт
+		} else {
+			if err = n.send(conn); err == nil {
+				return // NetWriter закрыт
+			}
+			backoff = netMinBackoff // соединение было установлено
+		}
+		select {
+		case <-n.closed:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > netMaxBackoff {
+			backoff = netMaxBackoff
+		}
+	}
+}
+
+// attach сохраняет установленное соединение, чтобы Close мог прервать
+// отправку. Возвращает false, если NetWriter уже закрыт.
+func (n *NetWriter) attach(conn net.Conn) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	select {
+	case <-n.closed:
+		return false
+	default:
+	}
+	n.conn = conn
+	n.state.Err = nil
+	n.state.Reconnects++
+	return true
+}
+
+// send отправляет записи из очереди в соединение, ожидая появления новых
+// записей, пока NetWriter не закрыт. При ошибке соединение закрывается и
+// ошибка возвращается; nil возвращается после закрытия NetWriter.
+func (n *NetWriter) send(conn net.Conn) error {
+	var data []byte
+	for {
+		n.mu.Lock()
+		record, err := n.spool.peek()
+		if err == nil && record == nil { // очередь пуста
+			if !n.state.Connected {
+				n.state.Connected = true
+				n.state.Since = time.Now()
+			}
+			n.mu.Unlock()
+			select {
+			case <-n.closed:
+				return nil
+			case <-n.wake:
+				continue
+			}
+		}
+		// запись копируется, так как очередь может измениться во время
+		// отправки
+		data = append(data[:0], record...)
+		var sent = n.sent
+		n.mu.Unlock()
+		if err == nil {
+			conn.SetWriteDeadline(time.Now().Add(netWriteTimeout))
+			var written int
+			written, err = conn.Write(data[sent:])
+			n.mu.Lock()
+			n.sent += written
+			if err == nil {
+				err = n.spool.pop()
+				n.sent = 0
+			}
+			n.mu.Unlock()
+		}
+		if err != nil {
+			conn.Close()
+			n.mu.Lock()
+			n.conn = nil
+			var closed bool
+			select {
+			case <-n.closed:
+				closed = true
+			default:
+				n.setError(err)
+			}
+			n.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// dial устанавливает соединение.
+func (n *NetWriter) dial() (net.Conn, error) {
+	var dialer = &net.Dialer{Timeout: netDialTimeout}
+	if n.config != nil {
+		return tls.DialWithDialer(dialer, n.network, n.address, n.config)
+	}
+	return dialer.Dial(n.network, n.address)
+}
+
+// spool описывает очередь записей, ожидающих отправки.
+type spool interface {
+	push(p []byte) error   // добавляет запись в конец очереди
+	peek() ([]byte, error) // возвращает первую запись или nil
+	pop() error            // удаляет первую запись
+	size() int64           // размер записей в очереди
+	sync() error           // сохраняет очередь
+	close() error          // закрывает очередь
+}
+
+// memSpool описывает очередь записей в памяти.
+type memSpool struct {
+	records [][]byte
+	n       int64
+	limit   int64
+}
+
+func (s *memSpool) push(p []byte) error {
+	if s.n+int64(len(p)) > s.limit {
+		return ErrSpoolFull
+	}
+	s.records = append(s.records, append([]byte(nil), p...))
+	s.n += int64(len(p))
+	return nil
+}
+
+func (s *memSpool) peek() ([]byte, error) {
+	if len(s.records) == 0 {
+		return nil, nil
+	}
+	return s.records[0], nil
+}
+
+func (s *memSpool) pop() error {
+	s.n -= int64(len(s.records[0]))
+	s.records[0] = nil
+	s.records = s.records[1:]
+	return nil
+}
+
+func (s *memSpool) size() int64  { return s.n }
+func (s *memSpool) sync() error  { return nil }
+func (s *memSpool) close() error { return nil }
+
+// fileSpool описывает очередь записей в файле. Файл начинается с
+// 8-байтового заголовка со смещением первой не отправленной записи, а
+// каждая запись сохраняется с 4-байтовым заголовком, содержащим ее длину.
+// Смещение обновляется после отправки каждой записи, поэтому после закрытия
+// отправленные записи повторно не отправляются. Размер файла не превышает
+// limit вместе с заголовком: если новая запись не помещается в конец файла,
+// то не отправленные записи переносятся в его начало.
+type fileSpool struct {
+	f     *os.File
+	r, w  int64 // смещения первой записи и конца очереди
+	limit int64
+	buf   []byte
+}
+
+// spoolHeaderSize задает размер заголовка файла очереди.
+const spoolHeaderSize = 8
+
+// openFileSpool открывает файл очереди. Недописанная последняя запись,
+// оставшаяся после аварийного завершения, отбрасывается.
+func openFileSpool(path string, limit int64) (*fileSpool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	var s = &fileSpool{f: f, limit: limit + spoolHeaderSize}
+	if err := s.open(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open читает заголовок файла и находит конец последней целой записи.
+func (s *fileSpool) open() error {
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	var header [spoolHeaderSize]byte
+	s.r = spoolHeaderSize
+	if info.Size() >= spoolHeaderSize {
+		if _, err := s.f.ReadAt(header[:], 0); err != nil {
+			return err
+		}
+		if r := int64(binary.BigEndian.Uint64(header[:])); r > s.r && r <= info.Size() {
+			s.r = r
+		}
+	}
+	s.w = s.r
+	for s.w+4 <= info.Size() {
+		if _, err := s.f.ReadAt(header[:4], s.w); err != nil {
+			return err
+		}
+		var next = s.w + 4 + int64(binary.BigEndian.Uint32(header[:4]))
+		if next > info.Size() {
+			break
+		}
+		s.w = next
+	}
+	if s.r == s.w {
+		return s.reset()
+	}
+	if s.w < info.Size() {
+		return s.f.Truncate(s.w)
+	}
+	return nil
+}
+
+// reset очищает файл очереди.
+func (s *fileSpool) reset() error {
+	s.r, s.w = spoolHeaderSize, spoolHeaderSize
+	if err := s.f.Truncate(s.w); err != nil {
+		return err
+	}
+	return s.writeHeader()
+}
+
+// writeHeader сохраняет смещение первой записи.
+func (s *fileSpool) writeHeader() error {
+	var header [spoolHeaderSize]byte
+	binary.BigEndian.PutUint64(header[:], uint64(s.r))
+	_, err := s.f.WriteAt(header[:], 0)
+	return err
+}
+
+// compact переносит не отправленные записи в начало файла.
+func (s *fileSpool) compact() error {
+	var data = make([]byte, s.w-s.r)
+	if _, err := s.f.ReadAt(data, s.r); err != nil {
+		return err
+	}
+	if _, err := s.f.WriteAt(data, spoolHeaderSize); err != nil {
+		return err
+	}
+	s.r, s.w = spoolHeaderSize, spoolHeaderSize+int64(len(data))
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	return s.f.Truncate(s.w)
+}
+
+func (s *fileSpool) push(p []byte) error {
+	var size = 4 + int64(len(p))
+	if spoolHeaderSize+s.w-s.r+size > s.limit {
+		return ErrSpoolFull
+	}
+	if s.w+size > s.limit {
+		if err := s.compact(); err != nil {
+			return err
+		}
+	}
+	s.buf = append(s.buf[:0], 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(s.buf, uint32(len(p)))
+	s.buf = append(s.buf, p...)
+	if _, err := s.f.WriteAt(s.buf, s.w); err != nil {
+		s.f.Truncate(s.w) // отбрасываем недописанную запись
+		return err
+	}
+	s.w += size
+	return nil
+}
+
+func (s *fileSpool) peek() ([]byte, error) {
+	if s.r >= s.w {
+		return nil, nil
+	}
+	var header [4]byte
+	if _, err := s.f.ReadAt(header[:], s.r); err != nil {
+		return nil, err
+	}
+	var data = make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := s.f.ReadAt(data, s.r+4); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *fileSpool) pop() error {
+	var header [4]byte
+	if _, err := s.f.ReadAt(header[:], s.r); err != nil {
+		return err
+	}
+	s.r += 4 + int64(binary.BigEndian.Uint32(header[:]))
+	if s.r < s.w {
+		return s.writeHeader()
+	}
+	return s.reset() // все записи отправлены
+}
+
+func (s *fileSpool) size() int64  { return s.w - s.r }
+func (s *fileSpool) sync() error  { return s.f.Sync() }
+func (s *fileSpool) close() error { return s.f.Close() }
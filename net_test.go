@@ -0,0 +1,157 @@
+package log
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNetWriter(t *testing.T) {
+	netMinBackoff = 10 * time.Millisecond
+	defer func() { netMinBackoff = 100 * time.Millisecond }()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	var addr = ln.Addr().String()
+	ln.Close() // сервер пока недоступен
+
+	var path = filepath.Join(t.TempDir(), "spool")
+	w, err := NewNetWriter("tcp", addr, nil, path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("a\n"))
+	w.Write([]byte("b\n"))
+	if state := w.State(); state.Connected || state.Pending != 12 {
+		t.Errorf("bad state: %v", state)
+	}
+	w.Close()
+
+	// записи из файла очереди отправляются после перезапуска
+	w, err = NewNetWriter("tcp", addr, nil, path, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte("c\n")); err != nil {
+		t.Error(err)
+	}
+	if _, err := w.Write([]byte("too long\n")); err != ErrSpoolFull {
+		t.Errorf("spool overflow: %v", err)
+	}
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var r = bufio.NewReader(conn)
+	for _, want := range []string{"a\n", "b\n", "c\n"} {
+		if line, err := r.ReadString('\n'); line != want {
+			t.Fatalf("bad line: %q %v, want %q", line, err, want)
+		}
+	}
+	for i := 0; i < 100 && !w.State().Connected; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.Write([]byte("d\n"))
+	if line, err := r.ReadString('\n'); line != "d\n" {
+		t.Errorf("bad line: %q %v", line, err)
+	}
+	// запись удаляется из очереди после отправки
+	for i := 0; i < 100 && !w.State().Connected; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state := w.State(); !state.Connected || state.Pending != 0 ||
+		state.Dropped != 1 || state.Reconnects != 1 {
+		t.Errorf("bad state: %v", state)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != spoolHeaderSize {
+		t.Errorf("spool not truncated: %v", err)
+	}
+}
+
+// partialConn отправляет только часть первой записи и возвращает ошибку.
+type partialConn struct {
+	net.Conn
+	sent []byte
+}
+
+func (c *partialConn) Write(p []byte) (int, error) {
+	if c.sent == nil {
+		c.sent = append(c.sent, p[:2]...)
+		return 2, net.ErrClosed
+	}
+	c.sent = append(c.sent, p...)
+	return len(p), nil
+}
+
+func TestNetWriterPartial(t *testing.T) {
+	var n = &NetWriter{
+		spool:  &memSpool{limit: 100},
+		wake:   make(chan struct{}, 1),
+		closed: make(chan bool),
+	}
+	n.spool.push([]byte("first\n"))
+	n.spool.push([]byte("second\n"))
+	client, server := net.Pipe()
+	defer server.Close()
+	var conn = &partialConn{Conn: client}
+	if err := n.send(conn); err != net.ErrClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// после ошибки отправляется только оставшаяся часть записи
+	var done = make(chan error)
+	go func() { done <- n.send(conn) }()
+	for i := 0; i < 100 && !n.State().Connected; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(n.closed)
+	<-done
+	if string(conn.sent) != "first\nsecond\n" {
+		t.Errorf("bad output: %q", conn.sent)
+	}
+	if state := n.State(); state.Pending != 0 {
+		t.Errorf("bad state: %v", state)
+	}
+}
+
+func TestFileSpool(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "spool")
+	s, err := openFileSpool(path, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.push([]byte("a\n"))
+	s.push([]byte("b\n"))
+	s.pop()
+	s.close()
+	// отправленные записи после закрытия не возвращаются
+	if s, err = openFileSpool(path, 20); err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if data, err := s.peek(); string(data) != "b\n" || s.size() != 6 {
+		t.Fatalf("bad first record: %q %v", data, err)
+	}
+	// новые записи во время отправки не увеличивают файл
+	for i := 0; i < 100; i++ {
+		if err := s.push([]byte("next\n")); err != nil {
+			t.Fatal(err)
+		}
+		s.pop()
+		if info, _ := s.f.Stat(); info.Size() > spoolHeaderSize+20 {
+			t.Fatalf("spool file too large: %d", info.Size())
+		}
+	}
+	if data, _ := s.peek(); string(data) != "next\n" || s.size() != 9 {
+		t.Errorf("bad spool: %q %d", data, s.size())
+	}
+}
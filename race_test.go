@@ -0,0 +1,7 @@
+//go:build race
+
+package log
+
+// raceEnabled указывает, что тесты запущены с детектором гонок, при котором
+// sync.Pool случайно отбрасывает объекты.
+const raceEnabled = true
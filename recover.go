@@ -0,0 +1,77 @@
+package log
+
+import (
+	"net/http"
+)
+
+// Recover перехватывает panic и записывает её в лог с уровнем ERROR вместе со
+// стеком вызовов. Должен вызываться непосредственно с помощью defer:
+//
+//	defer log.Recover()
+func (l *Logger) Recover() {
+	if r := recover(); r != nil {
+		l.recovered(r, ERROR)
+	}
+}
+
+// RecoverLevel перехватывает panic и записывает её в лог с указанным уровнем
+// вместе со стеком вызовов. Для уровня FATAL и выше после этого приложение
+// завершается так же, как при вызове Fatal. Если указан repanic, то после
+// записи в лог panic вызывается повторно с тем же значением. Должен
+// вызываться непосредственно с помощью defer.
+func (l *Logger) RecoverLevel(lvl Level, repanic bool) {
+	if r := recover(); r != nil {
+		l.recovered(r, lvl)
+		if repanic {
+			panic(r)
+		}
+	}
+}
+
+// Go выполняет функцию в отдельной горутине, перехватывая возникшую в ней
+// panic и записывая её в лог с помощью Recover.
+func (l *Logger) Go(fn func()) {
+	go func() {
+		defer l.Recover()
+		fn()
+	}()
+}
+
+// RecoverHandler возвращает обработчик HTTP-запросов, который перехватывает
+// panic, возникшую при обработке запроса, записывает её в лог с уровнем ERROR
+// и возвращает клиенту ошибку 500, если ответ еще не начал передаваться.
+// Значение http.ErrAbortHandler не записывается в лог и передается дальше.
+func (l *Logger) RecoverHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rw = &responseWriter{ResponseWriter: w}
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				l.With("method", r.Method, "url", r.URL.String()).
+					recovered(rec, ERROR)
+				if rw.status != 0 {
+					return // заголовок ответа уже отправлен
+				}
+				http.Error(rw, http.StatusText(http.StatusInternalServerError),
+					http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recovered записывает в лог информацию о перехваченной panic. Должна
+// вызываться из функции, вызванной с помощью defer.
+func (l *Logger) recovered(r interface{}, lvl Level) {
+	var value = Any("panic", r)
+	if err, ok := r.(error); ok {
+		value = Field{Name: "panic", kind: errorKind, Value: err}
+	}
+	l.LogFields(lvl, "panic recovered", value,
+		Array("stack", callers(1, true)))
+	if lvl >= FATAL {
+		exit(l.h)
+	}
+}
@@ -0,0 +1,129 @@
+package log
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader описывает обработчик лога, цепочка вывода которого создается по
+// настройкам из файла и автоматически пересоздается при изменении файла.
+// Переключение выполняется только после завершения всех начатых записей,
+// поэтому записи при обновлении настроек не теряются.
+type Reloader struct {
+	filename string
+	mu       sync.RWMutex
+	p        *Pipeline // текущая цепочка обработчиков
+	modTime  time.Time // время изменения файла с настройками
+	done     chan struct{}
+}
+
+// WatchConfig загружает настройки лога из файла и создает по ним цепочку
+// обработчиков. Файл проверяется на изменения с указанным интервалом. Если
+// интервал не положительный, то автоматическая проверка не выполняется и
+// настройки обновляются только вызовом Reload. Ошибки загрузки измененных
+// настроек записываются в лог с уровнем ERROR, при этом продолжают
+// действовать прежние настройки.
+func WatchConfig(filename string, interval time.Duration) (*Reloader, error) {
+	var r = &Reloader{filename: filename, done: make(chan struct{})}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go r.watch(interval)
+	}
+	return r, nil
+}
+
+// watch периодически проверяет изменение файла с настройками.
+func (r *Reloader) watch(interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fi, err := os.Stat(r.filename)
+			if err != nil {
+				r.Write(ERROR, "log", "config reload failed", []Field{Err(err)})
+				continue
+			}
+			r.mu.RLock()
+			var changed = !fi.ModTime().Equal(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				r.Write(ERROR, "log", "config reload failed", []Field{Err(err)})
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Reload загружает настройки из файла и пересоздает цепочку обработчиков.
+// Прежняя цепочка сбрасывается и закрывается.
+func (r *Reloader) Reload() error {
+	fi, err := os.Stat(r.filename)
+	if err != nil {
+		return err
+	}
+	config, err := LoadConfig(r.filename)
+	if err == nil {
+		var p *Pipeline
+		if p, err = config.Build(); err == nil {
+			r.mu.Lock()
+			var old = r.p
+			r.p = p
+			r.modTime = fi.ModTime()
+			r.mu.Unlock()
+			if old != nil {
+				old.Flush()
+				old.Close()
+			}
+			return nil
+		}
+	}
+	// не пытаемся повторно загрузить те же ошибочные настройки
+	r.mu.Lock()
+	r.modTime = fi.ModTime()
+	r.mu.Unlock()
+	return err
+}
+
+// Enabled поддерживает интерфейс Enabler.
+func (r *Reloader) Enabled(lvl Level, category string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.p.Enabled(lvl, category)
+}
+
+// Write поддерживает интерфейс Handler.
+func (r *Reloader) Write(lvl Level, category, msg string, fields []Field) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.p.Write(lvl, category, msg, fields)
+}
+
+// Flush сбрасывает буферизованные записи текущей цепочки обработчиков.
+func (r *Reloader) Flush() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.p.Flush()
+}
+
+// Close прекращает отслеживание изменений и закрывает файлы лога. Повторный
+// вызов ничего не делает.
+func (r *Reloader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		return nil // уже закрыт
+	default:
+	}
+	close(r.done)
+	r.p.Flush()
+	return r.p.Close()
+}
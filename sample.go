@@ -0,0 +1,79 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sampler ограничивает количество одинаковых записей в лог. В течение
+// каждого интервала времени Tick записи с одинаковым уровнем и текстом
+// сообщения передаются обработчику только первые First раз, а после этого
+// только каждая Thereafter-я запись. Если Thereafter равен нулю, то после
+// первых записей остальные до конца интервала отбрасываются.
+type Sampler struct {
+	h          Handler
+	tick       time.Duration
+	first      int
+	thereafter int
+	mu         sync.Mutex
+	reset      time.Time         // время начала текущего интервала
+	counts     map[sampleKey]int // количество записей в текущем интервале
+	dropped    uint64            // количество отброшенных записей
+}
+
+// sampleKey описывает ключ для подсчета одинаковых записей.
+type sampleKey struct {
+	lvl      Level
+	category string
+	msg      string
+}
+
+// NewSampler возвращает обработчик, ограничивающий количество одинаковых
+// записей, передаваемых обработчику h.
+func NewSampler(h Handler, tick time.Duration, first, thereafter int) *Sampler {
+	return &Sampler{h: h, tick: tick, first: first, thereafter: thereafter,
+		counts: make(map[sampleKey]int)}
+}
+
+// Enabled поддерживает интерфейс Enabler.
+func (s *Sampler) Enabled(lvl Level, category string) bool {
+	return enabled(s.h, lvl, category)
+}
+
+// Write передает запись обработчику, если она не превышает ограничений.
+func (s *Sampler) Write(lvl Level, category, msg string, fields []Field) error {
+	if !enabled(s.h, lvl, category) {
+		return nil
+	}
+	var key = sampleKey{lvl, category, msg}
+	var now = time.Now()
+	s.mu.Lock()
+	if now.Sub(s.reset) >= s.tick {
+		s.reset = now
+		for key := range s.counts {
+			delete(s.counts, key)
+		}
+	}
+	var n = s.counts[key] + 1
+	s.counts[key] = n
+	s.mu.Unlock()
+	if n > s.first && (s.thereafter <= 0 || (n-s.first)%s.thereafter != 0) {
+		atomic.AddUint64(&s.dropped, 1)
+		return nil
+	}
+	return s.h.Write(lvl, category, msg, fields)
+}
+
+// Dropped возвращает количество отброшенных записей.
+func (s *Sampler) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Flush сбрасывает буферизованные записи обработчика.
+func (s *Sampler) Flush() error {
+	if f, ok := s.h.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package log
+
+import (
+	"os"
+	"os/signal"
+)
+
+// OnSignal вызывает функцию при получении любого из указанных сигналов.
+// Возвращает функцию для прекращения обработки сигналов. Например, для
+// переключения уровня лога по сигналу SIGUSR1:
+//
+//	stop := log.OnSignal(w.CycleLevel, syscall.SIGUSR1)
+func OnSignal(fn func(), sig ...os.Signal) (stop func()) {
+	var ch = make(chan os.Signal, 1)
+	var done = make(chan struct{})
+	signal.Notify(ch, sig...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
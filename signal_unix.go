@@ -0,0 +1,18 @@
+//go:build unix
+
+package log
+
+import "syscall"
+
+// HandleSignals включает обработку сигналов для лога по умолчанию: SIGUSR1
+// переключает уровень лога по кругу (INFO, DEBUG, TRACE), а SIGHUP заново
+// применяет настройки из переменной окружения LOG. Возвращает функцию для
+// прекращения обработки сигналов.
+func HandleSignals() (stop func()) {
+	var cycle = OnSignal(h.CycleLevel, syscall.SIGUSR1)
+	var reload = OnSignal(func() { h.Reload() }, syscall.SIGHUP)
+	return func() {
+		cycle()
+		reload()
+	}
+}
@@ -9,31 +9,54 @@ import (
 // StackError описывает стандартную ошибку с добавлением информации о стеке
 // вызовов.
 type StackError struct {
-	Err   error    // оригинальная ошибка
-	Stack []Source // стек вызовов
+	Err   error // оригинальная ошибка
+	Stack Stack // стек вызовов
 }
 
 // NewError формирует новую ошибку, добавляя информацию о стеке вызовов.
 func NewError(err error) *StackError {
-	var result = &StackError{Err: err}
-	var pc [32]uintptr
-	n := runtime.Callers(2, pc[:])
+	return &StackError{Err: err, Stack: callers(1, false)}
+}
+
+// Stack описывает стек вызовов. Выводится в лог в виде массива строк с
+// именем файла, номером строки и названием функции.
+type Stack []Source
+
+// MarshalLogArray поддерживает интерфейс ArrayMarshaler.
+func (s Stack) MarshalLogArray(enc ArrayEncoder) {
+	for _, src := range s {
+		enc.Append(String("", src.String()+" "+src.Func))
+	}
+}
+
+// callers возвращает стек вызовов, начиная с функции, вызвавшей callers, с
+// пропуском указанного количества функций. Если задан panicking, то
+// дополнительно пропускаются все функции до вызова panic включительно.
+// Системные функции в стек не включаются.
+func callers(skip int, panicking bool) Stack {
+	var pc [64]uintptr
+	n := runtime.Callers(skip+2, pc[:])
 	if n == 0 {
-		return result
+		return nil
 	}
-	result.Stack = make([]Source, 0, n-1)
+	var stack = make(Stack, 0, n)
 	frames := runtime.CallersFrames(pc[:n])
-	for {
-		frame, more := frames.Next()
+	for more := true; more; {
+		var frame runtime.Frame
+		frame, more = frames.Next()
+		if panicking {
+			panicking = frame.Function != "runtime.gopanic"
+			continue
+		}
 		if strings.HasPrefix(frame.Function, "runtime.") {
+			if len(stack) == 0 {
+				continue // функции обработки panic, например runtime.sigpanic
+			}
 			break // не заполняем системными функциями
 		}
-		result.Stack = append(result.Stack, newSource(frame))
-		if !more {
-			break
-		}
+		stack = append(stack, newSource(frame))
 	}
-	return result
+	return stack
 }
 
 // Error возвращает строковое описание ошибки.
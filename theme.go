@@ -0,0 +1,75 @@
+package log
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// Theme описывает цветовую схему для вывода лога в формате Color. Цвета
+// задаются параметрами управляющих последовательностей ANSI (SGR), например
+// "36", "1;91", а также с помощью функций ANSI256 и TrueColor. Пустая строка
+// означает вывод без выделения цветом.
+type Theme struct {
+	Time     string           // время записи и значения с временем
+	Levels   map[Level]string // цвета уровней вместо заданных в LevelInfo
+	Category string           // название раздела
+	Message  string           // текст сообщения
+	Key      string           // имена дополнительных полей
+	Punct    string           // разделители и скобки
+	String   string           // строковые значения
+	Number   string           // числовые значения и интервалы времени
+	Bool     string           // логические значения
+	Error    string           // ошибки
+	Nil      string           // пустые значения
+}
+
+// DefaultTheme задает цветовую схему, используемую по умолчанию.
+var DefaultTheme = Theme{
+	Time:     "2",
+	Category: "92",
+	Key:      "36",
+	Punct:    "2",
+}
+
+// ANSI256 возвращает параметры для вывода текста цветом из палитры в 256
+// цветов.
+func ANSI256(n uint8) string {
+	return "38;5;" + strconv.Itoa(int(n))
+}
+
+// TrueColor возвращает параметры для вывода текста цветом RGB.
+func TrueColor(r, g, b uint8) string {
+	return "38;2;" + strconv.Itoa(int(r)) + ";" + strconv.Itoa(int(g)) + ";" +
+		strconv.Itoa(int(b))
+}
+
+// ColorEnabled возвращает true, если для вывода в поток следует использовать
+// цветовое выделение. Учитываются переменные окружения: FORCE_COLOR
+// включает цвет, NO_COLOR и TERM=dumb выключают. Если ни одна из них не
+// задана, то цвет используется только для вывода в терминал.
+func ColorEnabled(w io.Writer) bool {
+	if _, ok := os.LookupEnv("FORCE_COLOR"); ok || !colorAllowed() {
+		return colorAllowed()
+	}
+	return isTerminal(w)
+}
+
+// colorAllowed возвращает false, если цветовое выделение запрещено
+// переменными окружения NO_COLOR или TERM=dumb.
+func colorAllowed() bool {
+	if force, ok := os.LookupEnv("FORCE_COLOR"); ok {
+		return force != "0" && force != "false"
+	}
+	return os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+}
+
+// isTerminal возвращает true, если поток является терминалом.
+func isTerminal(w io.Writer) bool {
+	if out, ok := w.(*os.File); ok {
+		if fi, err := out.Stat(); err == nil {
+			return fi.Mode()&(os.ModeDevice|os.ModeCharDevice) != 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package log
+
+import "time"
+
+// Timer измеряет время выполнения операции и при остановке записывает его в
+// лог в поле "elapsed". Создается с помощью Logger.Timer.
+type Timer struct {
+	l          *Logger
+	msg        string
+	fields     []interface{}
+	start      time.Time
+	lvl        Level
+	thresholds []threshold
+}
+
+// threshold описывает уровень записи при превышении времени выполнения.
+type threshold struct {
+	d   time.Duration
+	lvl Level
+}
+
+// Timer запускает таймер. При вызове Stop в лог будет записано сообщение с
+// указанными полями и временем выполнения. По умолчанию используется
+// уровень INFO.
+//
+//	defer log.Timer("request", "path", path).Threshold(time.Second, log.WARN).Stop()
+func (l *Logger) Timer(msg string, fields ...interface{}) *Timer {
+	return &Timer{l: l, msg: msg, fields: fields, start: time.Now(), lvl: INFO}
+}
+
+// Level задает уровень записи, используемый, если время выполнения не
+// превысило ни одного из порогов.
+func (t *Timer) Level(lvl Level) *Timer {
+	t.lvl = lvl
+	return t
+}
+
+// Threshold задает уровень записи, используемый, если время выполнения
+// больше или равно d. Если задано несколько порогов, то используется
+// уровень наибольшего из превышенных.
+func (t *Timer) Threshold(d time.Duration, lvl Level) *Timer {
+	t.thresholds = append(t.thresholds, threshold{d, lvl})
+	return t
+}
+
+// Stop записывает в лог время выполнения с момента запуска таймера и
+// возвращает его. Дополнительные поля добавляются к указанным при запуске.
+func (t *Timer) Stop(fields ...interface{}) time.Duration {
+	var elapsed = time.Since(t.start)
+	var lvl, limit = t.lvl, time.Duration(-1)
+	for _, th := range t.thresholds {
+		if elapsed >= th.d && th.d > limit {
+			lvl, limit = th.lvl, th.d
+		}
+	}
+	if t.l.Enabled(lvl) {
+		var list = make([]interface{}, 0, len(t.fields)+len(fields)+1)
+		list = append(append(list, t.fields...), fields...)
+		t.l.write(lvl, t.msg, append(list, Duration("elapsed", elapsed)))
+	}
+	return elapsed
+}
+
+// Enter записывает в лог с уровнем TRACE сообщение о входе в функцию с
+// указанным именем и возвращает функцию, записывающую сообщение о выходе из
+// нее с временем выполнения. Если уровень TRACE не выводится, то ничего не
+// записывается.
+//
+//	defer log.Enter("handler", "id", id)()
+func (l *Logger) Enter(name string, fields ...interface{}) func() {
+	if !l.Enabled(TRACE) {
+		return func() {}
+	}
+	var ctx = l.With(append([]interface{}{"func", name}, fields...)...)
+	ctx.write(TRACE, "enter", nil)
+	var start = time.Now()
+	return func() {
+		ctx.LogFields(TRACE, "exit", Duration("elapsed", time.Since(start)))
+	}
+}
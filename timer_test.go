@@ -0,0 +1,40 @@
+package log
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimer(t *testing.T) {
+	var out = new(strings.Builder)
+	var log = NewWriter(out, DEBUG, new(Console))
+	var timer = log.Timer("query", "table", "users").Level(DEBUG).
+		Threshold(time.Second, WARN).Threshold(time.Minute, ERROR)
+	timer.start = timer.start.Add(-2 * time.Second)
+	if d := timer.Stop("rows", 5); d < 2*time.Second {
+		t.Errorf("bad elapsed time: %v", d)
+	}
+	if got := out.String(); !strings.HasPrefix(got,
+		`WARN query table="users" rows=5 elapsed=2`) {
+		t.Errorf("bad timer output: %q", got)
+	}
+	out.Reset()
+	log.Timer("fast").Level(DEBUG).Threshold(time.Hour, ERROR).Stop()
+	if got := out.String(); !strings.HasPrefix(got, "DEBUG fast elapsed=") {
+		t.Errorf("bad timer output: %q", got)
+	}
+
+	out.Reset()
+	log.Enter("handler")()
+	if out.Len() != 0 {
+		t.Errorf("unexpected trace output: %q", out.String())
+	}
+	log = NewWriter(out, TRACE, new(Console))
+	log.Enter("handler", "id", 1)()
+	var lines = strings.Split(out.String(), "\n")
+	if len(lines) != 3 || lines[0] != `TRACE enter func="handler" id=1` ||
+		!strings.HasPrefix(lines[1], `TRACE exit func="handler" id=1 elapsed=`) {
+		t.Errorf("bad enter output: %q", out.String())
+	}
+}
@@ -4,50 +4,120 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Encoder описывает интерфейс для форматирования записей лога. Используется
-// Writer для задания формата. Данная библиотека содержит поддержку двух
-// форматов логов: Console и JSON.
+// Writer для задания формата. Метод Encode добавляет представление записи к
+// переданному буферу и возвращает результат. Данная библиотека содержит
+// поддержку нескольких форматов логов: Console, Color, Logfmt и JSON.
+//
+// В предыдущих версиях метод Encode не принимал буфер и возвращал новый
+// срез. Такие форматы подключаются с помощью LegacyEncoder.
 type Encoder interface {
-	Encode(entry *Entry) []byte
+	Encode(dst []byte, entry *Entry) []byte
+}
+
+// LegacyEncoder позволяет использовать формат с методом Encode(*Entry) []byte
+// из предыдущих версий в качестве Encoder. Такой формат выделяет память при
+// каждой записи.
+func LegacyEncoder(enc interface{ Encode(entry *Entry) []byte }) Encoder {
+	return legacyEncoder{enc}
+}
+
+// legacyEncoder поддерживает формат с интерфейсом предыдущих версий.
+type legacyEncoder struct {
+	enc interface{ Encode(entry *Entry) []byte }
+}
+
+// Encode поддерживает интерфейс Encoder.
+func (e legacyEncoder) Encode(dst []byte, entry *Entry) []byte {
+	return append(dst, e.enc.Encode(entry)...)
 }
 
 // Writer описывает обработчик лога, записывающего в файл, консоль или
 // другой поток.
 type Writer struct {
-	enc Encoder
-	lvl Level
-	w   io.Writer
-	mu  sync.RWMutex
+	state atomic.Value // *writerState с текущими настройками
+	mu    sync.Mutex   // блокировка изменения настроек и записи в поток
+	// восстановление настроек после временного изменения
+	revert  *time.Timer
+	saved   *writerState
+	changed changes
+	errs    failures // ошибки записи в поток
 	Logger
 }
 
+// writerState описывает настройки Writer. При любом изменении настроек
+// создается их новая копия, поэтому для чтения блокировка не требуется.
+type writerState struct {
+	enc   Encoder
+	lvl   Level
+	w     io.Writer
+	hooks []Hook
+	// минимальные уровни для отдельных разделов лога
+	categories map[string]Level
+	fallback   io.Writer // резервный поток вывода
+	failures   int       // количество ошибок подряд до перехода на fallback
+}
+
 // NewWriter возвращает новый обработчик лога.
 func NewWriter(w io.Writer, lvl Level, enc Encoder) *Writer {
 	if enc == nil {
 		enc = new(Console)
 	}
-	var h = &Writer{w: w, lvl: lvl, enc: enc}
+	var h = new(Writer)
+	h.state.Store(&writerState{w: w, lvl: lvl, enc: enc})
 	h.Logger = Logger{h: h}
 	return h
 }
 
+// load возвращает текущие настройки.
+func (h *Writer) load() *writerState {
+	state, _ := h.state.Load().(*writerState)
+	if state == nil {
+		return new(writerState)
+	}
+	return state
+}
+
+// update изменяет копию текущих настроек и сохраняет её, если функция
+// изменения не вернула ошибку.
+func (h *Writer) update(fn func(state *writerState) error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var state = *h.load()
+	if err := fn(&state); err != nil {
+		return err
+	}
+	h.state.Store(&state)
+	return nil
+}
+
 // SetLevel устанавливает новый минимальный уровень для вывода в лог.
 func (h *Writer) SetLevel(lvl Level) {
-	h.mu.Lock()
-	h.lvl = lvl
-	h.mu.Unlock()
+	h.update(func(state *writerState) error {
+		state.lvl = lvl
+		return nil
+	})
+}
+
+// GetLevel возвращает текущий минимальный уровень для вывода в лог.
+func (h *Writer) GetLevel() Level {
+	return h.load().lvl
 }
 
 // SetOutput переопределяет вывод лога. Если nil, то лог выводиться не будет.
 func (h *Writer) SetOutput(w io.Writer) {
-	h.mu.Lock()
-	h.w = w
-	h.mu.Unlock()
+	h.update(func(state *writerState) error {
+		state.w = w
+		return nil
+	})
 }
 
 // SetFormat задает свойства форматирования записей лога.
@@ -55,117 +125,402 @@ func (h *Writer) SetFormat(enc Encoder) {
 	if enc == nil {
 		enc = new(Console)
 	}
-	h.mu.Lock()
-	h.enc = enc
-	h.mu.Unlock()
+	h.update(func(state *writerState) error {
+		state.enc = enc
+		return nil
+	})
+}
+
+// SetErrorHandler задает функцию, вызываемую при ошибках записи в поток
+// вывода лога.
+func (h *Writer) SetErrorHandler(fn ErrorHandler) {
+	h.errs.setHandler(fn)
 }
 
-// String возвращает уровень и формат вывода лога.
+// SetFallback задает резервный поток вывода, например, os.Stderr, в
+// который выводятся записи после failures ошибок записи в основной поток
+// подряд. Пока используется резервный поток, запись в основной периодически
+// повторяется, и при успехе вывод в него возобновляется. Если w равен nil,
+// то резервный поток не используется и все записи выводятся в основной.
+func (h *Writer) SetFallback(w io.Writer, failures int) {
+	if failures <= 0 {
+		failures = 1
+	}
+	h.update(func(state *writerState) error {
+		state.fallback, state.failures = w, failures
+		return nil
+	})
+}
+
+// ErrorState возвращает состояние ошибок записи в поток вывода лога.
+func (h *Writer) ErrorState() ErrorState {
+	return h.errs.get()
+}
+
+// AddHook добавляет функции для обработки записей лога перед их
+// форматированием. Функции вызываются в порядке их добавления. Если
+// какая-либо из них возвращает false, то запись отбрасывается, а оставшиеся
+// функции не вызываются.
+func (h *Writer) AddHook(hooks ...Hook) {
+	h.update(func(state *writerState) error {
+		state.hooks = append(state.hooks[:len(state.hooks):len(state.hooks)],
+			hooks...)
+		return nil
+	})
+}
+
+// String возвращает текущие настройки лога в том же формате, который
+// используется в Set: уровень, формат вывода и уровни для отдельных разделов.
 func (h *Writer) String() string {
-	h.mu.RLock()
-	var level string
-	switch h.lvl {
-	case -128:
-		level = "ALL"
-	case 127:
-		level = "NONE"
-	case TRACE:
-		level = "TRACE"
-	case DEBUG:
-		level = "DEBUG"
-	case INFO:
-		level = "INFO"
-	case ERROR:
-		level = "ERROR"
-	case FATAL:
-		level = "FATAL"
-	default:
-		level = strconv.Itoa(int(h.lvl))
-	}
-	switch h.enc.(type) {
+	var state = h.load()
+	var opts = []string{levelName(state.lvl)}
+	switch enc := state.enc.(type) {
 	case *JSON:
-		level += ":JSON"
+		opts = append(opts, "JSON")
+	case *Logfmt:
+		opts = append(opts, "LOGFMT")
 	case *Color:
-		level += ":COL"
+		if enc.NewLine {
+			opts = append(opts, "DEV")
+		} else {
+			opts = append(opts, "COL")
+		}
+		if enc.TimeFormat != "" {
+			opts = append(opts, "time="+quoteOption(enc.TimeFormat))
+		}
 	case *Console:
+		opts = append(opts, "STD", "time="+quoteOption(enc.TimeFormat))
+	}
+	var names = make([]string, 0, len(state.categories))
+	for name := range state.categories {
+		names = append(names, name)
 	}
-	h.mu.RUnlock()
-	return level
+	sort.Strings(names)
+	for _, name := range names {
+		opts = append(opts, name+"="+levelName(state.categories[name]))
+	}
+	return strings.Join(opts, ",")
 }
 
-// Set устанавливает уровень и формат вывода лога.
+// Set изменяет настройки лога. Настройки задаются строкой с перечислением
+// параметров через запятую: уровень (trace, debug, info, warn, error, panic,
+// fatal, all, none или число), формат вывода (json, logfmt, std, color, dev
+// или auto для выбора color при выводе в терминал и std в остальных
+// случаях), формат времени ("time=15:04:05") и уровни для отдельных
+// разделов лога ("db=debug"). Уровень раздела действует и на все вложенные в
+// него разделы. Пустое значение уровня ("db=") удаляет настройку для
+// раздела. Формат времени, содержащий запятую или кавычку, задается в
+// кавычках по правилам Go: time="Jan 2, 2006".
 func (h *Writer) Set(opt string) error {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	for _, opt := range strings.Split(opt, ",") {
-		switch opt := strings.ToLower(opt); opt {
-		case "all", "a", "*":
-			h.lvl = -128
-		case "trace", "trc", "t":
-			h.lvl = TRACE
-		case "debug", "dbg", "d":
-			h.lvl = DEBUG
-		case "info", "inf", "i":
-			h.lvl = INFO
-		case "warning", "warn", "wrn", "w":
-			h.lvl = WARN
-		case "error", "err", "r":
-			h.lvl = ERROR
-		case "fatal", "ftl", "f":
-			h.lvl = FATAL
-		case "none", "no", "n", "off", "false":
-			h.lvl = 127
+	return h.update(func(state *writerState) error {
+		return state.set(opt)
+	})
+}
+
+// changes описывает настройки, измененные строкой параметров.
+type changes struct {
+	lvl        bool            // уровень лога
+	enc        bool            // формат вывода
+	categories map[string]bool // уровни разделов
+}
+
+// merge добавляет к описанию изменения из other.
+func (c *changes) merge(other changes) {
+	c.lvl = c.lvl || other.lvl
+	c.enc = c.enc || other.enc
+	for name := range other.categories {
+		if c.categories == nil {
+			c.categories = make(map[string]bool)
+		}
+		c.categories[name] = true
+	}
+}
+
+// restore возвращает в state сохраненные значения измененных настроек.
+func (s *writerState) restore(state *writerState, c changes) {
+	if c.lvl {
+		state.lvl = s.lvl
+	}
+	if c.enc {
+		state.enc = s.enc
+	}
+	if len(c.categories) == 0 {
+		return
+	}
+	var categories = make(map[string]Level, len(state.categories))
+	for name, lvl := range state.categories {
+		categories[name] = lvl
+	}
+	for name := range c.categories {
+		if lvl, ok := s.categories[name]; ok {
+			categories[name] = lvl
+		} else {
+			delete(categories, name)
+		}
+	}
+	state.categories = categories
+}
+
+// set изменяет настройки в соответствии с переданной строкой.
+func (s *writerState) set(opts string) error {
+	return s.apply(opts, new(changes))
+}
+
+// apply изменяет настройки в соответствии с переданной строкой и отмечает
+// в c, какие из них изменены.
+func (s *writerState) apply(opts string, c *changes) error {
+	list, err := splitOptions(opts)
+	if err != nil {
+		return err
+	}
+	for _, opt := range list {
+		var lower = strings.ToLower(opt)
+		if lvl, ok := parseLevel(lower); ok {
+			s.lvl, c.lvl = lvl, true
+			continue
+		}
+		switch lower {
 		case "json", "jsn", "j":
-			h.enc = new(JSON)
+			s.enc, c.enc = new(JSON), true
+		case "logfmt", "lf":
+			s.enc, c.enc = new(Logfmt), true
 		case "standart", "std", "s", "console":
-			h.enc = &Console{TimeFormat: "2006-01-02 15:04:05"}
+			s.enc, c.enc = &Console{TimeFormat: "2006-01-02 15:04:05"}, true
 		case "colors", "color", "col", "c":
-			h.enc = new(Color)
+			s.enc, c.enc = &Color{Plain: !colorAllowed()}, true
 		case "developers", "developer", "develop", "dev":
-			h.enc = &Color{KeyIndent: 8, NewLine: true}
+			s.enc, c.enc = &Color{KeyIndent: 8, NewLine: true, Plain: !colorAllowed()}, true
+		case "auto":
+			c.enc = true
+			if ColorEnabled(s.w) {
+				s.enc = new(Color)
+			} else {
+				s.enc = &Console{TimeFormat: "2006-01-02 15:04:05"}
+			}
 		case "":
 		default:
-			if strings.HasPrefix(opt, "time=") {
-				if enc, ok := h.enc.(*Console); ok {
-					enc.TimeFormat = opt[5:]
+			var pos = strings.IndexByte(opt, '=')
+			if pos <= 0 {
+				return fmt.Errorf("unknown log format %q", opt)
+			}
+			var name, value = opt[:pos], opt[pos+1:]
+			if lower[:pos] == "time" {
+				if strings.HasPrefix(value, `"`) {
+					if value, err = strconv.Unquote(value); err != nil {
+						return fmt.Errorf("bad time format %s", opt[pos+1:])
+					}
+				}
+				switch enc := s.enc.(type) { // не изменяем используемый формат
+				case *Console:
+					var console = *enc
+					console.TimeFormat = value
+					s.enc = &console
+				case *Color:
+					var color = *enc
+					color.TimeFormat = value
+					s.enc = &color
 				}
-			} else if lvl, err := strconv.ParseInt(opt, 10, 8); err == nil {
-				h.lvl = Level(lvl)
+				c.enc = true
+				continue
+			}
+			// уровень для раздела лога
+			var categories = make(map[string]Level, len(s.categories)+1)
+			for name, lvl := range s.categories {
+				categories[name] = lvl
+			}
+			if value == "" {
+				delete(categories, name)
+			} else if lvl, ok := parseLevel(strings.ToLower(value)); ok {
+				categories[name] = lvl
 			} else {
-				return fmt.Errorf("unknown log format %q", opt)
+				return fmt.Errorf("unknown log level %q for %q", value, name)
+			}
+			s.categories = categories
+			if c.categories == nil {
+				c.categories = make(map[string]bool)
 			}
+			c.categories[name] = true
 		}
 	}
 	return nil
 }
 
-// IsTTY возвращает true, если поток является терминалом или файлом.
-func (h *Writer) IsTTY() bool {
-	h.mu.RLock()
-	if out, ok := h.w.(*os.File); ok {
-		if fi, err := out.Stat(); err == nil {
-			h.mu.RUnlock()
-			return fi.Mode()&(os.ModeDevice|os.ModeCharDevice) != 0
+// level возвращает минимальный уровень записей для раздела лога. Если для
+// раздела или его родителей задан отдельный уровень, то используется
+// уровень ближайшего из них.
+func (s *writerState) level(category string) Level {
+	if len(s.categories) == 0 {
+		return s.lvl
+	}
+	for name := category; name != ""; {
+		if lvl, ok := s.categories[name]; ok {
+			return lvl
 		}
+		var pos = strings.LastIndexByte(name, '.')
+		if pos < 0 {
+			break
+		}
+		name = name[:pos]
 	}
-	h.mu.RUnlock()
-	return false
+	return s.lvl
+}
+
+// SetFor временно изменяет настройки лога на указанное время, после чего
+// восстанавливает прежние значения только тех настроек, которые были
+// изменены: уровня, формата вывода или уровней указанных разделов. Другие
+// изменения, сделанные за это время с помощью Set, сохраняются, но если они
+// затрагивают те же настройки, то будут отменены. Повторный вызов до
+// истечения времени продлевает действие изменений, при этом
+// восстанавливаются значения, действовавшие до первого вызова.
+func (h *Writer) SetFor(opt string, d time.Duration) error {
+	return h.update(func(state *writerState) error {
+		var changed changes
+		if err := state.apply(opt, &changed); err != nil {
+			return err
+		}
+		if h.revert != nil { // предыдущие изменения еще действуют
+			h.revert.Stop()
+		} else {
+			h.saved, h.changed = h.load(), changes{}
+		}
+		h.changed.merge(changed)
+		var timer *time.Timer
+		timer = time.AfterFunc(d, func() {
+			h.update(func(state *writerState) error {
+				if h.revert != timer {
+					return nil // заменен повторным вызовом SetFor
+				}
+				h.saved.restore(state, h.changed)
+				h.revert, h.saved, h.changed = nil, nil, changes{}
+				return nil
+			})
+		})
+		h.revert = timer
+		return nil
+	})
+}
+
+// CycleLevel переключает уровень лога по кругу: INFO, DEBUG, TRACE и снова
+// INFO. Используется для изменения уровня по сигналу.
+func (h *Writer) CycleLevel() {
+	h.update(func(state *writerState) error {
+		switch {
+		case state.lvl > INFO:
+			state.lvl = INFO
+		case state.lvl > DEBUG:
+			state.lvl = DEBUG
+		case state.lvl > TRACE:
+			state.lvl = TRACE
+		default:
+			state.lvl = INFO
+		}
+		return nil
+	})
+}
+
+// Reload сбрасывает уровни разделов и заново применяет настройки из
+// переменной окружения LOG.
+func (h *Writer) Reload() error {
+	return h.update(func(state *writerState) error {
+		state.categories = nil
+		return state.set(os.Getenv("LOG"))
+	})
+}
+
+// Flush сбрасывает буферизованные данные потока вывода лога, если он
+// поддерживает метод Flush или Sync.
+func (h *Writer) Flush() error {
+	var w = h.load().w
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch w := w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Sync() error }:
+		return w.Sync()
+	}
+	return nil
+}
+
+// IsTTY возвращает true, если поток является терминалом или файлом.
+func (h *Writer) IsTTY() bool {
+	return isTerminal(h.load().w)
+}
+
+// Enabled возвращает true, если запись с указанным уровнем будет выведена в
+// лог.
+func (h *Writer) Enabled(lvl Level, category string) bool {
+	var state = h.load()
+	return state.enc != nil && state.w != nil && lvl >= state.level(category)
 }
 
 // Write поддерживает интерфейс записи логов Handler.
 func (h *Writer) Write(lvl Level, category, msg string, fields []Field) error {
-	h.mu.RLock()
-	if h.enc == nil || h.w == nil || lvl < h.lvl {
-		h.mu.RUnlock()
+	var state = h.load()
+	var limit = state.level(category)
+	if state.enc == nil || state.w == nil || lvl < limit {
 		return nil
 	}
-	h.mu.RUnlock()
 	var entry = NewEntry(lvl, category, msg, fields)
-	var buf = h.enc.Encode(entry)
-	entry.Free()
+	defer entry.Free()
+	for _, hook := range state.hooks {
+		if !hook(entry) {
+			return nil
+		}
+	}
+	if entry.Level < limit { // уровень мог быть понижен обработчиком
+		return nil
+	}
+	var buf = getBuffer()
+	*buf = state.enc.Encode(*buf, entry)
+	var fallback func() error
+	if state.fallback != nil {
+		fallback = func() error { return h.output(state.fallback, *buf) }
+	}
+	err := h.errs.write(entry.Level, entry.Category, entry.Message, state.failures,
+		func() error { return h.output(state.w, *buf) }, fallback)
+	buf.Free()
+	return err
+}
+
+// output выводит запись в поток.
+func (h *Writer) output(w io.Writer, data []byte) error {
 	h.mu.Lock()
-	_, err := h.w.Write(buf)
+	_, err := w.Write(data)
 	h.mu.Unlock()
-	buffers.Put(buf)
 	return err
 }
+
+// quoteOption возвращает значение параметра для Set, заключая его в кавычки,
+// если оно содержит запятую или кавычку.
+func quoteOption(s string) string {
+	if strings.ContainsAny(s, `,"`) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// splitOptions разделяет строку параметров по запятым, не учитывая запятые
+// внутри значений в кавычках.
+func splitOptions(s string) ([]string, error) {
+	var opts []string
+	var start int
+	var quoted, escaped bool
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			opts = append(opts, s[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	return append(opts, s[start:]), nil
+}